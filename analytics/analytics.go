@@ -0,0 +1,295 @@
+// Package analytics summarizes how long slabs stay in stock, and when vendors
+// restock, from the FirstSeen, LastSeen and Gone times of the known slabs.
+//
+// Slabs first seen on the day a vendor was first fetched were already in
+// stock, so they don't count as new arrivals, and only slabs which are gone
+// count towards the days in stock, since the rest haven't sold yet.
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+// Options control the Report.
+type Options struct {
+	// Now is when the Report is made.
+	Now time.Time
+	// Location is the time zone of days and months, the local one if nil.
+	Location *time.Location
+	// MinLength is the shortest slab in the Sizes, in inches.
+	MinLength float64
+	// BinWidth is the range of lengths in each Size, in inches, 6 if zero.
+	BinWidth float64
+}
+
+// Report is the summary of a set of slabs.
+type Report struct {
+	Generated    time.Time
+	MinLength    float64
+	TimeOnMarket []TimeOnMarket
+	Restocks     []Restock
+	Weekdays     []Weekdays
+	Sizes        []Size
+}
+
+// TimeOnMarket is how long the slabs of one color and finish stay in stock at
+// one vendor.
+type TimeOnMarket struct {
+	Vendor  string
+	Color   string
+	Finish  string
+	InStock int // slabs still in stock
+	Gone    int // slabs which have sold
+	// MedianDays is the median number of days the Gone slabs were in
+	// stock, or zero if there are none.
+	MedianDays float64
+}
+
+// Restock is how often one vendor gets new slabs of one color.
+type Restock struct {
+	Vendor   string
+	Color    string
+	Restocks int // the number of days with new slabs
+	NewSlabs int // the number of new lots or bundles
+	// MeanDaysBetween is the mean days between restocks, or zero if there
+	// was only one.
+	MeanDaysBetween float64
+	Last            time.Time // the day of the last restock
+}
+
+// Weekdays counts the new slabs of one vendor by the day of the week they were
+// first seen.
+type Weekdays struct {
+	Vendor  string
+	Counts  [7]int // indexed by time.Weekday
+	Typical string // the weekday with the most new slabs
+}
+
+// Size counts the long slabs first seen in one month, in one range of
+// lengths.
+type Size struct {
+	Month      string // eg. "2024-03"
+	MinLength  float64
+	MaxLength  float64 // exclusive
+	Slabs      int
+	Gone       int
+	MedianDays float64 // of the Gone slabs, or zero
+}
+
+// Analyze summarizes the slabs.  Slabs which were never seen are ignored.
+func Analyze(slabs []slabfinder.Slab, opts Options) Report {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	bin := opts.BinWidth
+	if bin <= 0 {
+		bin = 6
+	}
+	var seen []slabfinder.Slab
+	for _, s := range slabs {
+		if !s.FirstSeen.IsZero() {
+			seen = append(seen, s)
+		}
+	}
+	// The first day each vendor was seen, anything first seen then was
+	// already in stock.
+	start := make(map[slabfinder.Vendor]time.Time)
+	for _, s := range seen {
+		d := day(s.FirstSeen, loc)
+		if t, ok := start[s.Vendor]; !ok || d.Before(t) {
+			start[s.Vendor] = d
+		}
+	}
+	isNew := func(s slabfinder.Slab) bool { return day(s.FirstSeen, loc).After(start[s.Vendor]) }
+
+	return Report{
+		Generated:    opts.Now,
+		MinLength:    opts.MinLength,
+		TimeOnMarket: timeOnMarket(seen),
+		Restocks:     restocks(seen, isNew, loc),
+		Weekdays:     weekdays(seen, isNew, loc),
+		Sizes:        sizes(seen, opts.MinLength, bin, loc),
+	}
+}
+
+func timeOnMarket(slabs []slabfinder.Slab) []TimeOnMarket {
+	type key struct{ vendor, color, finish string }
+	groups := make(map[key]*TimeOnMarket)
+	days := make(map[key][]float64)
+	for _, s := range slabs {
+		k := key{s.Vendor.String(), s.Color, s.Finish.String()}
+		g := groups[k]
+		if g == nil {
+			g = &TimeOnMarket{Vendor: k.vendor, Color: k.color, Finish: k.finish}
+			groups[k] = g
+		}
+		if s.Gone.IsZero() {
+			g.InStock++
+			continue
+		}
+		g.Gone++
+		days[k] = append(days[k], daysInStock(s))
+	}
+	var tom []TimeOnMarket
+	for k, g := range groups {
+		g.MedianDays = median(days[k])
+		tom = append(tom, *g)
+	}
+	sort.Slice(tom, func(i, j int) bool {
+		a, b := tom[i], tom[j]
+		if a.Vendor != b.Vendor {
+			return a.Vendor < b.Vendor
+		}
+		if a.Color != b.Color {
+			return a.Color < b.Color
+		}
+		return a.Finish < b.Finish
+	})
+	return tom
+}
+
+func restocks(slabs []slabfinder.Slab, isNew func(slabfinder.Slab) bool, loc *time.Location) []Restock {
+	type key struct{ vendor, color string }
+	groups := make(map[key]*Restock)
+	days := make(map[key]map[time.Time]bool)
+	for _, s := range slabs {
+		if !isNew(s) {
+			continue
+		}
+		k := key{s.Vendor.String(), s.Color}
+		g := groups[k]
+		if g == nil {
+			g = &Restock{Vendor: k.vendor, Color: k.color}
+			groups[k] = g
+			days[k] = make(map[time.Time]bool)
+		}
+		g.NewSlabs++
+		days[k][day(s.FirstSeen, loc)] = true
+	}
+	var rs []Restock
+	for k, g := range groups {
+		var first time.Time
+		for d := range days[k] {
+			if first.IsZero() || d.Before(first) {
+				first = d
+			}
+			if d.After(g.Last) {
+				g.Last = d
+			}
+		}
+		g.Restocks = len(days[k])
+		if g.Restocks > 1 {
+			g.MeanDaysBetween = round(g.Last.Sub(first).Hours() / 24 / float64(g.Restocks-1))
+		}
+		rs = append(rs, *g)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Vendor != rs[j].Vendor {
+			return rs[i].Vendor < rs[j].Vendor
+		}
+		return rs[i].Color < rs[j].Color
+	})
+	return rs
+}
+
+func weekdays(slabs []slabfinder.Slab, isNew func(slabfinder.Slab) bool, loc *time.Location) []Weekdays {
+	groups := make(map[string]*Weekdays)
+	for _, s := range slabs {
+		if !isNew(s) {
+			continue
+		}
+		g := groups[s.Vendor.String()]
+		if g == nil {
+			g = &Weekdays{Vendor: s.Vendor.String()}
+			groups[g.Vendor] = g
+		}
+		g.Counts[s.FirstSeen.In(loc).Weekday()]++
+	}
+	var ws []Weekdays
+	for _, g := range groups {
+		typical := time.Sunday
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if g.Counts[d] > g.Counts[typical] {
+				typical = d
+			}
+		}
+		g.Typical = typical.String()
+		ws = append(ws, *g)
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i].Vendor < ws[j].Vendor })
+	return ws
+}
+
+func sizes(slabs []slabfinder.Slab, min, bin float64, loc *time.Location) []Size {
+	type key struct {
+		month string
+		min   float64
+	}
+	groups := make(map[key]*Size)
+	days := make(map[key][]float64)
+	for _, s := range slabs {
+		if s.Length < min {
+			continue
+		}
+		lo := math.Floor(s.Length/bin) * bin
+		k := key{s.FirstSeen.In(loc).Format("2006-01"), lo}
+		g := groups[k]
+		if g == nil {
+			g = &Size{Month: k.month, MinLength: lo, MaxLength: lo + bin}
+			groups[k] = g
+		}
+		g.Slabs++
+		if !s.Gone.IsZero() {
+			g.Gone++
+			days[k] = append(days[k], daysInStock(s))
+		}
+	}
+	var ss []Size
+	for k, g := range groups {
+		g.MedianDays = median(days[k])
+		ss = append(ss, *g)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Month != ss[j].Month {
+			return ss[i].Month < ss[j].Month
+		}
+		return ss[i].MinLength < ss[j].MinLength
+	})
+	return ss
+}
+
+// daysInStock is how long a gone slab was in stock, until it was last seen.
+// Its Gone time may be much later, if it was sold before slabwatcher
+// recorded when slabs were gone.
+func daysInStock(s slabfinder.Slab) float64 {
+	return s.LastSeen.Sub(s.FirstSeen).Hours() / 24
+}
+
+// day returns midnight at the start of t's day in loc.
+func day(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// median returns the median of xs, to a tenth, or zero if there are none.
+func median(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sort.Float64s(xs)
+	m := xs[len(xs)/2]
+	if len(xs)%2 == 0 {
+		m = (xs[len(xs)/2-1] + m) / 2
+	}
+	return round(m)
+}
+
+// round rounds x to a tenth.
+func round(x float64) float64 {
+	return math.Round(x*10) / 10
+}
@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+func TestAnalyze(t *testing.T) {
+	// 2024-03-04 is a Monday.
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 9, 0, 0, 0, time.UTC) }
+	slab := func(v slabfinder.Vendor, color string, length float64, first, gone int) slabfinder.Slab {
+		s := slabfinder.Slab{Vendor: v, Color: color, Finish: slabfinder.Leather, Length: length, FirstSeen: day(first)}
+		if gone > 0 {
+			s.LastSeen, s.Gone = day(gone).Add(-15*time.Minute), day(gone)
+		}
+		return s
+	}
+	slabs := []slabfinder.Slab{
+		// Already in stock when Cosmos was first fetched.
+		slab(slabfinder.Cosmos, "Titanium", 130, 1, 3),
+		slab(slabfinder.Cosmos, "Titanium", 110, 1, 0),
+		// Restocked on two Mondays.
+		slab(slabfinder.Cosmos, "Titanium", 126, 4, 8),
+		slab(slabfinder.Cosmos, "Titanium", 131, 4, 0),
+		slab(slabfinder.Cosmos, "Titanium", 138, 18, 20),
+		slab(slabfinder.Cosmos, "White", 100, 19, 0),
+		slab(slabfinder.OHM, "White", 120, 2, 0),
+		{Vendor: slabfinder.OHM, Color: "Never seen"},
+	}
+	got := Analyze(slabs, Options{Now: day(21), Location: time.UTC, MinLength: 126})
+	want := Report{
+		Generated: day(21),
+		MinLength: 126,
+		TimeOnMarket: []TimeOnMarket{
+			{Vendor: "Cosmos", Color: "Titanium", Finish: "Leather", InStock: 2, Gone: 3, MedianDays: 2},
+			{Vendor: "Cosmos", Color: "White", Finish: "Leather", InStock: 1},
+			{Vendor: "OHM", Color: "White", Finish: "Leather", InStock: 1},
+		},
+		Restocks: []Restock{
+			{Vendor: "Cosmos", Color: "Titanium", Restocks: 2, NewSlabs: 3, MeanDaysBetween: 14, Last: time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC)},
+			{Vendor: "Cosmos", Color: "White", Restocks: 1, NewSlabs: 1, Last: time.Date(2024, 3, 19, 0, 0, 0, 0, time.UTC)},
+		},
+		Weekdays: []Weekdays{
+			{Vendor: "Cosmos", Counts: [7]int{time.Monday: 3, time.Tuesday: 1}, Typical: "Monday"},
+		},
+		Sizes: []Size{
+			{Month: "2024-03", MinLength: 126, MaxLength: 132, Slabs: 3, Gone: 2, MedianDays: 3},
+			{Month: "2024-03", MinLength: 138, MaxLength: 144, Slabs: 1, Gone: 1, MedianDays: 2},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Analyze():\n%s", diff)
+	}
+}
+
+func TestDaysInStock(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 9, 0, 0, 0, time.UTC) }
+	for _, tc := range []struct {
+		name string
+		slab slabfinder.Slab
+		want float64
+	}{
+		{"gone", slabfinder.Slab{FirstSeen: day(1), LastSeen: day(3), Gone: day(3).Add(15 * time.Minute)}, 2},
+		// An older version didn't mark it gone until long after it sold.
+		{"legacy", slabfinder.Slab{FirstSeen: day(1), LastSeen: day(3), Gone: day(30)}, 2},
+	} {
+		if got := daysInStock(tc.slab); got != tc.want {
+			t.Errorf("%s: daysInStock() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	for _, tc := range []struct {
+		in   []float64
+		want float64
+	}{
+		{nil, 0},
+		{[]float64{3}, 3},
+		{[]float64{5, 1, 3}, 3},
+		{[]float64{4, 1, 2, 3}, 2.5},
+		{[]float64{1.04, 1.26}, 1.2},
+	} {
+		if got := median(tc.in); got != tc.want {
+			t.Errorf("median(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
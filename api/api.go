@@ -0,0 +1,391 @@
+// Package api serves the watcher's state as JSON, for other tools:
+//
+//	GET /api/v1/slabs             the known slabs, filtered like the dashboard
+//	GET /api/v1/slabs/{id}        one slab, with its history
+//	GET /api/v1/vendors           the outcome of the last fetch of each vendor
+//	GET /api/v1/events?since=     what happened to the slabs since a time
+//
+// Lists are paginated with "limit" and "offset", and link to the next page.
+// Every response has an ETag, so unchanged data can be revalidated cheaply
+// with If-None-Match.  Incompatible changes will get a new version prefix.
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/criteria"
+	"github.com/asjoyner/slabfinder/dashboard"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// Prefix is the path the API is served under.
+const Prefix = "/api/v1/"
+
+// DefaultLimit and MaxLimit are the default and largest page sizes.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Source is the state served by the API, each function is called once per
+// request, and must not return anything which is modified afterwards.
+type Source struct {
+	Slabs   func() map[uint64]slabfinder.Slab
+	Vendors func() []Vendor
+	// Events returns the events after since, oldest first.
+	Events func(since time.Time) []Event
+}
+
+// Slab is a slabfinder.Slab as it appears in the API.
+type Slab struct {
+	ID        string     `json:"id"`
+	Vendor    string     `json:"vendor"`
+	Key       string     `json:"key,omitempty"`
+	Color     string     `json:"color"`
+	Finish    string     `json:"finish"`
+	Thickness float64    `json:"thickness_cm"`
+	Lot       string     `json:"lot"`
+	Bundle    string     `json:"bundle"`
+	Length    float64    `json:"length_in"`
+	Width     float64    `json:"width_in"`
+	Count     int        `json:"count"`
+	Price     int        `json:"price_cents"`
+	Location  string     `json:"location,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	Photo     string     `json:"photo,omitempty"`
+	FirstSeen time.Time  `json:"first_seen"`
+	LastSeen  time.Time  `json:"last_seen"`
+	Gone      *time.Time `json:"gone,omitempty"`
+	// History is only included for a single slab.
+	History []Change `json:"history,omitempty"`
+}
+
+// Change is a slabfinder.Change as it appears in the API.
+type Change struct {
+	Time  time.Time `json:"time"`
+	Kind  string    `json:"kind"`
+	Field string    `json:"field"`
+	Old   string    `json:"old"`
+	New   string    `json:"new"`
+}
+
+// Vendor is the outcome of the last fetch by one fetcher.
+type Vendor struct {
+	Fetcher     string     `json:"fetcher"`
+	Vendor      string     `json:"vendor"`
+	LastFetch   time.Time  `json:"last_fetch"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	Slabs       int        `json:"slabs"`
+	DurationMS  int64      `json:"duration_ms"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Event is something which happened to a slab.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // the notify.EventType, in lower case
+	Slab    Slab      `json:"slab"`
+	Changes []Change  `json:"changes,omitempty"`
+}
+
+// NewEvent returns an Event of type t, which happened to the slab at the given
+// time, with its changes.
+func NewEvent(at time.Time, t notify.EventType, s slabfinder.Slab, changes []slabfinder.Change) Event {
+	return Event{Time: at, Type: strings.ToLower(t.String()), Slab: NewSlab(s), Changes: NewChanges(changes)}
+}
+
+// NewSlab converts a slabfinder.Slab, without its history.
+func NewSlab(s slabfinder.Slab) Slab {
+	a := Slab{
+		ID: slabfinder.FormatID(s.ID()), Vendor: s.Vendor.String(), Key: s.Key, Color: s.Color, Finish: s.Finish.String(),
+		Thickness: s.Thickness, Lot: s.Lot, Bundle: s.Bundle, Length: s.Length, Width: s.Width, Count: s.Count,
+		Price: s.Price, Location: s.Location, URL: s.URL, Photo: s.Photo, FirstSeen: s.FirstSeen, LastSeen: s.LastSeen,
+	}
+	if !s.Gone.IsZero() {
+		gone := s.Gone
+		a.Gone = &gone
+	}
+	return a
+}
+
+// NewChanges converts slabfinder.Changes.
+func NewChanges(changes []slabfinder.Change) []Change {
+	var cs []Change
+	for _, c := range changes {
+		cs = append(cs, Change{Time: c.Time, Kind: c.Kind, Field: c.Field, Old: c.Old, New: c.New})
+	}
+	return cs
+}
+
+// SlabEvents returns the events which can be recovered from the slabs' state,
+// oldest first: when each was new, changed, and gone.  A slab which returned
+// isn't recorded, so those events are lost.
+func SlabEvents(slabs map[uint64]slabfinder.Slab) []Event {
+	var events []Event
+	for _, s := range slabs {
+		if !s.FirstSeen.IsZero() {
+			events = append(events, NewEvent(s.FirstSeen, notify.New, s, nil))
+		}
+		for i := 0; i < len(s.History); {
+			j := i + 1
+			for j < len(s.History) && s.History[j].Time.Equal(s.History[i].Time) {
+				j++
+			}
+			events = append(events, NewEvent(s.History[i].Time, notify.Changed, s, s.History[i:j]))
+			i = j
+		}
+		if !s.Gone.IsZero() {
+			events = append(events, NewEvent(s.Gone, notify.Gone, s, nil))
+		}
+	}
+	SortEvents(events)
+	return events
+}
+
+// SortEvents sorts events oldest first, and then by type and slab, so the
+// order is the same each time.
+func SortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Slab.ID < b.Slab.ID
+	})
+}
+
+// Handler serves the API.
+type Handler struct {
+	src Source
+}
+
+// New returns a Handler serving src.
+func New(src Source) *Handler {
+	return &Handler{src: src}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed", r.Method))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, Prefix)
+	switch {
+	case path == "slabs":
+		h.slabs(w, r)
+	case strings.HasPrefix(path, "slabs/"):
+		h.slab(w, r, strings.TrimPrefix(path, "slabs/"))
+	case path == "vendors":
+		h.vendors(w, r)
+	case path == "events":
+		h.events(w, r)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such endpoint %s", r.URL.Path))
+	}
+}
+
+// Page is one page of a list.
+type Page struct {
+	Total int    `json:"total"` // how many items there are in all pages
+	Next  string `json:"next,omitempty"`
+}
+
+// slabs serves the slabs matching the criteria.FromQuery parameters, without
+// those which are gone, unless "gone" is set.  They are sorted by ID, or by
+// "sort", one of the dashboard.Sorts.
+func (h *Handler) slabs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cond, err := criteria.FromQuery(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	less := func(a, b slabfinder.Slab) bool { return false }
+	if name := q.Get("sort"); name != "" && name != "id" {
+		s, ok := dashboard.LookupSort(name)
+		if !ok {
+			names := []string{"id"}
+			for _, s := range dashboard.Sorts {
+				names = append(names, s.Name)
+			}
+			writeError(w, http.StatusBadRequest, fmt.Errorf("sort: %q is not one of %s", name, strings.Join(names, ", ")))
+			return
+		}
+		less = s.Less
+	}
+	offset, limit, err := paging(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var slabs []slabfinder.Slab
+	for _, s := range h.src.Slabs() {
+		if (!s.Gone.IsZero() && q.Get("gone") == "") || !cond.Matches(s) {
+			continue
+		}
+		slabs = append(slabs, s)
+	}
+	sort.Slice(slabs, func(i, j int) bool {
+		a, b := slabs[i], slabs[j]
+		if less(a, b) || less(b, a) {
+			return less(a, b)
+		}
+		return a.ID() < b.ID()
+	})
+	page, lo, hi := paginate(w, r, len(slabs), offset, limit)
+	resp := struct {
+		Slabs []Slab `json:"slabs"`
+		Page
+	}{[]Slab{}, page}
+	for _, s := range slabs[lo:hi] {
+		resp.Slabs = append(resp.Slabs, NewSlab(s))
+	}
+	writeJSON(w, r, resp)
+}
+
+// slab serves one slab, with its history.
+func (h *Handler) slab(w http.ResponseWriter, r *http.Request, id string) {
+	n, err := slabfinder.ParseID(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%q is not a slab ID", id))
+		return
+	}
+	s, ok := h.src.Slabs()[n]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no slab %s", id))
+		return
+	}
+	a := NewSlab(s)
+	a.History = NewChanges(s.History)
+	writeJSON(w, r, a)
+}
+
+// vendors serves the outcome of the last fetch of each vendor.
+func (h *Handler) vendors(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		Vendors []Vendor `json:"vendors"`
+	}{[]Vendor{}}
+	resp.Vendors = append(resp.Vendors, h.src.Vendors()...)
+	writeJSON(w, r, resp)
+}
+
+// events serves the events after "since", an RFC 3339 time, or all of them
+// which are still kept.
+func (h *Handler) events(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("since: %q is not an RFC 3339 time", s))
+			return
+		}
+	}
+	offset, limit, err := paging(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	events := h.src.Events(since)
+	page, lo, hi := paginate(w, r, len(events), offset, limit)
+	resp := struct {
+		Events []Event `json:"events"`
+		Page
+	}{[]Event{}, page}
+	resp.Events = append(resp.Events, events[lo:hi]...)
+	writeJSON(w, r, resp)
+}
+
+// paging returns the "offset" and "limit" parameters, the limit is at most
+// MaxLimit.
+func paging(q url.Values) (offset, limit int, err error) {
+	limit = DefaultLimit
+	if s := q.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset: %q is not zero or more", s)
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("limit: %q is not one or more", s)
+		}
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	return offset, limit, nil
+}
+
+// paginate returns the Page of n items starting at offset, and the range of
+// items on it.  The next page is linked in the Link header too.
+func paginate(w http.ResponseWriter, r *http.Request, n, offset, limit int) (p Page, lo, hi int) {
+	p.Total = n
+	lo, hi = offset, offset+limit
+	if lo > n {
+		lo = n
+	}
+	if hi > n {
+		hi = n
+	}
+	if hi < n {
+		q := r.URL.Query()
+		q.Set("offset", strconv.Itoa(hi))
+		q.Set("limit", strconv.Itoa(limit))
+		p.Next = r.URL.Path + "?" + q.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, p.Next))
+	}
+	return p, lo, hi
+}
+
+// writeJSON writes v with an ETag of its encoding, or just the status if the
+// client already has it.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	etag := fmt.Sprintf(`"%x"`, sum[:16])
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache") // revalidate with the ETag
+	if match(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes())
+}
+
+// match reports whether an If-None-Match header matches etag.
+func match(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+var now = time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+
+var testSlabs = []slabfinder.Slab{
+	{Vendor: slabfinder.Cosmos, Key: "1", Color: "Titanium", Lot: "long", Finish: slabfinder.Leather, Thickness: 3, Length: 132, Width: 70,
+		FirstSeen: now.AddDate(0, 0, -40), LastSeen: now,
+		History: []slabfinder.Change{
+			{Time: now.AddDate(0, 0, -1), Kind: slabfinder.PriceChanged, Field: "Price", Old: "$1200.00", New: "$990.00"},
+			{Time: now.AddDate(0, 0, -1), Kind: slabfinder.CountDecreased, Field: "Count", Old: "4", New: "3"},
+		}},
+	{Vendor: slabfinder.Cosmos, Key: "2", Color: "Titanium", Lot: "wide", Finish: slabfinder.Polished, Thickness: 3, Length: 126, Width: 79,
+		FirstSeen: now.AddDate(0, 0, -2), LastSeen: now},
+	{Vendor: slabfinder.OHM, Key: "3", Color: "White Ice", Lot: "short", Thickness: 2, Length: 100, Width: 60,
+		FirstSeen: now.AddDate(0, 0, -10), LastSeen: now},
+	{Vendor: slabfinder.OHM, Key: "4", Color: "White Ice", Lot: "sold", Thickness: 2, Length: 140, Width: 60,
+		FirstSeen: now.AddDate(0, 0, -10), LastSeen: now.AddDate(0, 0, -2), Gone: now.AddDate(0, 0, -1)},
+}
+
+func testHandler() *Handler {
+	slabs := make(map[uint64]slabfinder.Slab)
+	for _, s := range testSlabs {
+		slabs[s.ID()] = s
+	}
+	events := SlabEvents(slabs)
+	success := now.Add(-time.Hour)
+	return New(Source{
+		Slabs: func() map[uint64]slabfinder.Slab { return slabs },
+		Vendors: func() []Vendor {
+			return []Vendor{
+				{Fetcher: "cosmos", Vendor: "Cosmos", LastFetch: now, LastSuccess: &now, Slabs: 2, DurationMS: 1200},
+				{Fetcher: "ohm", Vendor: "OHM", LastFetch: now, LastSuccess: &success, Error: "connection refused"},
+			}
+		},
+		Events: func(since time.Time) []Event {
+			for i, e := range events {
+				if e.Time.After(since) {
+					return events[i:]
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// get serves a request, and decodes the JSON response into v.
+func get(t *testing.T, h http.Handler, url string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	if v != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s: %s", url, err)
+		}
+	}
+	return rec
+}
+
+type slabsPage struct {
+	Slabs []Slab
+	Page
+}
+
+func lots(slabs []Slab) []string {
+	var lots []string
+	for _, s := range slabs {
+		lots = append(lots, s.Lot)
+	}
+	return lots
+}
+
+func TestSlabs(t *testing.T) {
+	h := testHandler()
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?sort=length", []string{"long", "wide", "short"}},
+		{"?sort=length&gone=1", []string{"sold", "long", "wide", "short"}},
+		{"?sort=newest", []string{"wide", "short", "long"}},
+		{"?sort=area", []string{"wide", "long", "short"}},
+		{"?vendor=cosmos&finish=leather", []string{"long"}},
+		{"?min_length=125&max_length=130", []string{"wide"}},
+		{"?sort=oldest", []string{"long", "short", "wide"}},
+		{"?color=ice&gone=1&sort=length", []string{"sold", "short"}},
+		{"?vendor=StoneBasyx", []string{}},
+	}
+	for _, tc := range tests {
+		var got slabsPage
+		rec := get(t, h, "/api/v1/slabs"+tc.query, &got)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%q: status %d: %s", tc.query, rec.Code, rec.Body)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, append([]string{}, lots(got.Slabs)...)); diff != "" {
+			t.Errorf("%q:\n%s", tc.query, diff)
+		}
+		if got.Total != len(tc.want) || got.Next != "" {
+			t.Errorf("%q: page %+v, want a total of %d and no next page", tc.query, got.Page, len(tc.want))
+		}
+	}
+	// An empty list is [], not null.
+	if rec := get(t, h, "/api/v1/slabs?vendor=StoneBasyx", nil); !strings.Contains(rec.Body.String(), `"slabs":[]`) {
+		t.Errorf("empty list: %s", rec.Body)
+	}
+
+	for _, query := range []string{"?min_length=long", "?sort=price", "?limit=0", "?offset=-1"} {
+		rec := get(t, h, "/api/v1/slabs"+query, nil)
+		var e struct{ Error string }
+		if err := json.Unmarshal(rec.Body.Bytes(), &e); rec.Code != http.StatusBadRequest || err != nil || e.Error == "" {
+			t.Errorf("%q: status %d, body %s, want a JSON error", query, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	h := testHandler()
+	var all []string
+	url := "/api/v1/slabs?sort=length&gone=1&limit=3"
+	for pages := 0; url != ""; pages++ {
+		if pages > 2 {
+			t.Fatalf("too many pages")
+		}
+		var got slabsPage
+		rec := get(t, h, url, &got)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", url, rec.Code)
+		}
+		if got.Total != 4 {
+			t.Errorf("%s: total %d, want 4", url, got.Total)
+		}
+		if got.Next != "" {
+			if link := rec.Header().Get("Link"); link != "<"+got.Next+`>; rel="next"` {
+				t.Errorf("%s: Link %q, want the next page %q", url, link, got.Next)
+			}
+		}
+		all = append(all, lots(got.Slabs)...)
+		url = got.Next
+	}
+	if diff := cmp.Diff([]string{"sold", "long", "wide", "short"}, all); diff != "" {
+		t.Errorf("pages:\n%s", diff)
+	}
+
+	// A page past the end is empty.
+	var got slabsPage
+	get(t, h, "/api/v1/slabs?offset=10", &got)
+	if len(got.Slabs) != 0 || got.Total != 3 {
+		t.Errorf("past the end: %+v", got)
+	}
+}
+
+func TestSlab(t *testing.T) {
+	h := testHandler()
+	long := testSlabs[0]
+	var got Slab
+	rec := get(t, h, "/api/v1/slabs/"+slabfinder.FormatID(long.ID()), &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := NewSlab(long)
+	want.History = NewChanges(long.History)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("slab:\n%s", diff)
+	}
+
+	var sold Slab
+	get(t, h, "/api/v1/slabs/"+slabfinder.FormatID(testSlabs[3].ID()), &sold)
+	if sold.Gone == nil || !sold.Gone.Equal(testSlabs[3].Gone) {
+		t.Errorf("gone = %v, want %s", sold.Gone, testSlabs[3].Gone)
+	}
+
+	for _, url := range []string{"/api/v1/slabs/0000000000000001", "/api/v1/slabs/nonsense", "/api/v1/slabs/", "/api/v1/bogus"} {
+		if rec := get(t, h, url, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d", url, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestVendors(t *testing.T) {
+	var got struct{ Vendors []Vendor }
+	get(t, testHandler(), "/api/v1/vendors", &got)
+	if len(got.Vendors) != 2 || got.Vendors[1].Error != "connection refused" || !got.Vendors[1].LastSuccess.Equal(now.Add(-time.Hour)) {
+		t.Errorf("vendors = %+v", got.Vendors)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	h := testHandler()
+	type event struct {
+		Type, Lot string
+		Changes   int
+	}
+	summarize := func(events []Event) []event {
+		var s []event
+		for _, e := range events {
+			s = append(s, event{e.Type, e.Slab.Lot, len(e.Changes)})
+		}
+		return s
+	}
+	var got struct {
+		Events []Event
+		Page
+	}
+	rec := get(t, h, "/api/v1/events?since="+now.AddDate(0, 0, -3).Format(time.RFC3339), &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := []event{{"new", "wide", 0}, {"changed", "long", 2}, {"gone", "sold", 0}}
+	if diff := cmp.Diff(want, summarize(got.Events)); diff != "" {
+		t.Errorf("events:\n%s", diff)
+	}
+
+	got.Events = nil
+	get(t, h, "/api/v1/events?limit=2", &got)
+	if got.Total != 6 || len(got.Events) != 2 || got.Events[0].Type != "new" || got.Next == "" {
+		t.Errorf("first page of all events: %+v", got)
+	}
+
+	if rec := get(t, h, "/api/v1/events?since=yesterday", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("since=yesterday: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestETag(t *testing.T) {
+	h := testHandler()
+	rec := get(t, h, "/api/v1/vendors", nil)
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("no ETag")
+	}
+	for header, want := range map[string]int{
+		etag:               http.StatusNotModified,
+		`"other", ` + etag: http.StatusNotModified,
+		"W/" + etag:        http.StatusNotModified,
+		`"other"`:          http.StatusOK,
+	} {
+		req := httptest.NewRequest("GET", "/api/v1/vendors", nil)
+		req.Header.Set("If-None-Match", header)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("If-None-Match %s: status %d, want %d", header, rec.Code, want)
+		}
+		if want == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: sent a body", header)
+		}
+	}
+
+	// Other resources have other tags.
+	if other := get(t, h, "/api/v1/slabs", nil).Header().Get("ETag"); other == etag {
+		t.Errorf("slabs and vendors have the same ETag")
+	}
+}
+
+func TestMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	testHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/slabs", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
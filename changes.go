@@ -0,0 +1,84 @@
+package slabfinder
+
+import (
+	"fmt"
+	"time"
+)
+
+// The kinds of Change, which can be chosen for notification.
+const (
+	CountDecreased    = "count_decreased"
+	CountIncreased    = "count_increased"
+	PriceChanged      = "price_changed"
+	DimensionsChanged = "dimensions_changed"
+	PhotoChanged      = "photo_changed"
+	URLChanged        = "url_changed"
+	DetailsChanged    = "details_changed" // the color, finish, thickness, lot or bundle
+)
+
+// ChangeKinds lists every kind of Change.
+var ChangeKinds = []string{CountDecreased, CountIncreased, PriceChanged, DimensionsChanged, PhotoChanged, URLChanged, DetailsChanged}
+
+// Change is a difference in one field of a slab between two fetches.
+type Change struct {
+	Time  time.Time
+	Kind  string // eg. CountDecreased
+	Field string // eg. "Count"
+	Old   string
+	New   string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s → %s", c.Field, c.Old, c.New)
+}
+
+// Diff returns the changes from old to new, at time t.  It ignores the
+// Vendor, Key and Location, which identify the slab, the Page it was listed
+// on, and the timestamps.
+func Diff(old, new Slab, t time.Time) []Change {
+	var changes []Change
+	add := func(kind, field string, o, n interface{}) {
+		changes = append(changes, Change{Time: t, Kind: kind, Field: field, Old: fmt.Sprint(o), New: fmt.Sprint(n)})
+	}
+	if new.Count < old.Count {
+		add(CountDecreased, "Count", old.Count, new.Count)
+	} else if new.Count > old.Count {
+		add(CountIncreased, "Count", old.Count, new.Count)
+	}
+	if new.Price != old.Price {
+		add(PriceChanged, "Price", dollars(old.Price), dollars(new.Price))
+	}
+	if new.Length != old.Length {
+		add(DimensionsChanged, "Length", old.Length, new.Length)
+	}
+	if new.Width != old.Width {
+		add(DimensionsChanged, "Width", old.Width, new.Width)
+	}
+	if new.Photo != old.Photo {
+		add(PhotoChanged, "Photo", old.Photo, new.Photo)
+	}
+	if new.URL != old.URL {
+		add(URLChanged, "URL", old.URL, new.URL)
+	}
+	if new.Color != old.Color {
+		add(DetailsChanged, "Color", old.Color, new.Color)
+	}
+	if new.Finish != old.Finish {
+		add(DetailsChanged, "Finish", old.Finish, new.Finish)
+	}
+	if new.Thickness != old.Thickness {
+		add(DetailsChanged, "Thickness", old.Thickness, new.Thickness)
+	}
+	if new.Lot != old.Lot {
+		add(DetailsChanged, "Lot", old.Lot, new.Lot)
+	}
+	if new.Bundle != old.Bundle {
+		add(DetailsChanged, "Bundle", old.Bundle, new.Bundle)
+	}
+	return changes
+}
+
+// dollars formats a price in pennies.
+func dollars(pennies int) string {
+	return fmt.Sprintf("$%d.%02d", pennies/100, pennies%100)
+}
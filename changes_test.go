@@ -0,0 +1,54 @@
+package slabfinder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	old := Slab{Lot: "6656", Count: 4, Price: 120000, Length: 130, Width: 77, URL: "https://example.com/6656",
+		Color: "Titanium", Finish: Polished, Thickness: 3, Bundle: "1497U"}
+	tests := []struct {
+		name   string
+		modify func(s *Slab)
+		want   []Change
+	}{
+		{"unchanged", func(s *Slab) { s.LastSeen = now }, nil},
+		{"sold two", func(s *Slab) { s.Count = 2 }, []Change{
+			{Time: now, Kind: CountDecreased, Field: "Count", Old: "4", New: "2"},
+		}},
+		{"restocked", func(s *Slab) { s.Count = 5 }, []Change{
+			{Time: now, Kind: CountIncreased, Field: "Count", Old: "4", New: "5"},
+		}},
+		{"marked down", func(s *Slab) { s.Price = 99950 }, []Change{
+			{Time: now, Kind: PriceChanged, Field: "Price", Old: "$1200.00", New: "$999.50"},
+		}},
+		{"remeasured", func(s *Slab) { s.Length, s.Width = 131.5, 76 }, []Change{
+			{Time: now, Kind: DimensionsChanged, Field: "Length", Old: "130", New: "131.5"},
+			{Time: now, Kind: DimensionsChanged, Field: "Width", Old: "77", New: "76"},
+		}},
+		{"moved", func(s *Slab) { s.URL = "https://example.com/lot/6656" }, []Change{
+			{Time: now, Kind: URLChanged, Field: "URL", Old: "https://example.com/6656", New: "https://example.com/lot/6656"},
+		}},
+		{"recataloged", func(s *Slab) {
+			s.Color, s.Finish, s.Thickness, s.Lot, s.Bundle = "Titanium Leathered", Leather, 2, "6657", "1498U"
+		}, []Change{
+			{Time: now, Kind: DetailsChanged, Field: "Color", Old: "Titanium", New: "Titanium Leathered"},
+			{Time: now, Kind: DetailsChanged, Field: "Finish", Old: "Polished", New: "Leather"},
+			{Time: now, Kind: DetailsChanged, Field: "Thickness", Old: "3", New: "2"},
+			{Time: now, Kind: DetailsChanged, Field: "Lot", Old: "6656", New: "6657"},
+			{Time: now, Kind: DetailsChanged, Field: "Bundle", Old: "1497U", New: "1498U"},
+		}},
+		{"relisted", func(s *Slab) { s.Page = "Titanium" }, nil},
+	}
+	for _, tc := range tests {
+		new := old
+		tc.modify(&new)
+		if diff := cmp.Diff(tc.want, Diff(old, new, now)); diff != "" {
+			t.Errorf("%s:\n%s", tc.name, diff)
+		}
+	}
+}
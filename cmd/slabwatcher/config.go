@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/criteria"
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
+	"github.com/asjoyner/slabfinder/notify"
+	"github.com/asjoyner/slabfinder/notify/discord"
+	"github.com/asjoyner/slabfinder/notify/email"
+	"github.com/asjoyner/slabfinder/notify/slack"
+	"github.com/asjoyner/slabfinder/notify/telegram"
+	"github.com/asjoyner/slabfinder/notify/webhook"
+	"github.com/asjoyner/slabfinder/store"
+	"github.com/asjoyner/slabfinder/store/jsonstore"
+	"github.com/asjoyner/slabfinder/store/sqlite"
+)
+
+// Config is the slabwatcher config file, by default
+// $XDG_CONFIG_HOME/slabfinder/config.yaml.  Any setting may be omitted to use
+// the default, and most can be overridden by flags.
+type Config struct {
+	// Store is where the state is kept, "sqlite" for Database, or "json" for
+	// StateFile and NotifiedFile.
+	Store string `yaml:"store"`
+	// Database holds the known slabs, every cycle's observations of them,
+	// and the notifications sent.  When it is created, any state in
+	// StateFile and NotifiedFile is imported.
+	Database string `yaml:"database"`
+	// StateFile holds the known slabs, with when they were first and last seen
+	StateFile string `yaml:"state_file"`
+	// NotifiedFile records which slabs each profile has been notified about
+	NotifiedFile string `yaml:"notified_file"`
+	// Backups is how many hourly backups of the state to keep
+	Backups int `yaml:"backups"`
+	// OutboxFile holds the notifications which have not been delivered yet
+	OutboxFile string `yaml:"outbox_file"`
+	// Interval is how long to sleep between fetching inventory
+	Interval time.Duration `yaml:"interval"`
+	// AlertAfter is how many consecutive cycles a vendor may be unreachable
+	// before an alert is sent
+	AlertAfter int `yaml:"alert_after"`
+	// Workers is how many vendors to fetch concurrently
+	Workers int `yaml:"workers"`
+	// Listen is the address to serve the dashboard on, eg. "localhost:8080",
+	// there is no dashboard if it is empty
+	Listen string `yaml:"listen"`
+	// Report is where to write the report of interesting slabs after each
+	// cycle.
+	Report ReportConfig `yaml:"report"`
+
+	HTTP HTTPConfig `yaml:"http"`
+
+	// Discord, Slack, Telegram and Email receive alerts about the watcher
+	// itself, and notifications for the default profile.
+	Discord  discord.Config  `yaml:"discord"`
+	Slack    slack.Config    `yaml:"slack"`
+	Telegram telegram.Config `yaml:"telegram"`
+	Email    email.Config    `yaml:"email"`
+	// Webhooks receive a request for each event for the default profile.
+	Webhooks []webhook.Config `yaml:"webhooks"`
+	// Criteria are the rules for which slabs are interesting to the default
+	// profile.
+	Criteria criteria.Criteria `yaml:"criteria"`
+	// Changes are the kinds of change to a notified slab which the default
+	// profile is notified about, eg. "count_decreased".
+	Changes []string `yaml:"changes"`
+	// Profiles each have their own criteria and notifications.  If there are
+	// none, there is one profile named "default", using Criteria and the
+	// top level notifications.
+	Profiles []Profile `yaml:"profiles"`
+
+	// Vendors configures each fetcher, by name.  A fetcher which is not listed
+	// is enabled with its default settings.
+	Vendors map[string]VendorConfig `yaml:"vendors"`
+}
+
+// HTTPConfig is the retry policy for requests to vendors
+type HTTPConfig struct {
+	Timeout  time.Duration `yaml:"timeout"`
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+	PerHost  int           `yaml:"per_host"`
+}
+
+// ReportConfig is where to write the report of the slabs which match any
+// profile's criteria.  Either may be empty to skip that format.
+type ReportConfig struct {
+	HTML     string `yaml:"html"`
+	Markdown string `yaml:"markdown"`
+}
+
+// Profile is one project's criteria for interesting slabs, and where to send
+// notifications about them.
+type Profile struct {
+	Name     string            `yaml:"name"`
+	Criteria criteria.Criteria `yaml:"criteria"`
+	Changes  []string          `yaml:"changes"`
+	Discord  discord.Config    `yaml:"discord"`
+	Slack    slack.Config      `yaml:"slack"`
+	Telegram telegram.Config   `yaml:"telegram"`
+	Email    email.Config      `yaml:"email"`
+	Webhooks []webhook.Config  `yaml:"webhooks"`
+}
+
+// VendorConfig is the section of the config file for one fetcher.  Settings
+// other than Enabled are passed to the fetcher, if it is
+// slabfinder.Configurable.
+type VendorConfig struct {
+	Enabled *bool // defaults to true
+	node    yaml.Node
+}
+
+// UnmarshalYAML keeps the node so it can be decoded again by the fetcher.
+func (v *VendorConfig) UnmarshalYAML(node *yaml.Node) error {
+	var enabled struct {
+		Enabled *bool `yaml:"enabled"`
+	}
+	if err := node.Decode(&enabled); err != nil {
+		return err
+	}
+	v.Enabled = enabled.Enabled
+	v.node = *node
+	return nil
+}
+
+// hasSettings reports whether the section contains anything but "enabled".
+func (v VendorConfig) hasSettings() bool {
+	for i := 0; i+1 < len(v.node.Content); i += 2 {
+		if v.node.Content[i].Value != "enabled" {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultConfig returns the settings used when there is no config file.
+func defaultConfig() *Config {
+	return &Config{
+		Store:        "sqlite",
+		Database:     filepath.Join(userDir(os.UserCacheDir), "slabs.db"),
+		StateFile:    filepath.Join(userDir(os.UserCacheDir), "slabs.json"),
+		NotifiedFile: filepath.Join(userDir(os.UserCacheDir), "notified.json"),
+		Backups:      24,
+		OutboxFile:   filepath.Join(userDir(os.UserCacheDir), "outbox.json"),
+		Interval:     15 * time.Minute,
+		AlertAfter:   4,
+		Workers:      4,
+		HTTP: HTTPConfig{
+			Timeout:  webclient.DefaultPolicy.Timeout,
+			Attempts: webclient.DefaultPolicy.MaxAttempts,
+			Backoff:  webclient.DefaultPolicy.InitialBackoff,
+			PerHost:  webclient.DefaultPolicy.MaxPerHost,
+		},
+		Discord: discord.Config{
+			WebhookFile: filepath.Join(userDir(os.UserConfigDir), "webhook"),
+		},
+		Criteria: minLengthCriteria(132),
+	}
+}
+
+// minLengthCriteria returns Criteria which match every slab at least min
+// inches long.
+func minLengthCriteria(min float64) criteria.Criteria {
+	return criteria.Criteria{{
+		Name:      "min_length",
+		Condition: criteria.Condition{Length: &criteria.Range{Min: &min}},
+	}}
+}
+
+// userDir returns the slabfinder subdirectory of the directory returned by
+// dirFunc, eg. os.UserConfigDir, or the current directory if there is none.
+func userDir(dirFunc func() (string, error)) string {
+	dir, err := dirFunc()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, "slabfinder")
+}
+
+// loadConfig reads the config file at path over the defaults.  If the file
+// does not exist and required is false, the defaults are returned.
+func loadConfig(path string, required bool) (*Config, error) {
+	cfg := defaultConfig()
+	input, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %s", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(input))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config %s: %s", path, err)
+	}
+	cfg.Database = expandHome(cfg.Database)
+	cfg.StateFile = expandHome(cfg.StateFile)
+	cfg.NotifiedFile = expandHome(cfg.NotifiedFile)
+	cfg.OutboxFile = expandHome(cfg.OutboxFile)
+	cfg.Report.HTML = expandHome(cfg.Report.HTML)
+	cfg.Report.Markdown = expandHome(cfg.Report.Markdown)
+	cfg.Discord.WebhookFile = expandHome(cfg.Discord.WebhookFile)
+	cfg.Slack.WebhookFile = expandHome(cfg.Slack.WebhookFile)
+	cfg.Telegram.TokenFile = expandHome(cfg.Telegram.TokenFile)
+	cfg.Email.PasswordFile = expandHome(cfg.Email.PasswordFile)
+	expandWebhooks(cfg.Webhooks)
+	for i := range cfg.Profiles {
+		cfg.Profiles[i].Discord.WebhookFile = expandHome(cfg.Profiles[i].Discord.WebhookFile)
+		cfg.Profiles[i].Slack.WebhookFile = expandHome(cfg.Profiles[i].Slack.WebhookFile)
+		cfg.Profiles[i].Telegram.TokenFile = expandHome(cfg.Profiles[i].Telegram.TokenFile)
+		cfg.Profiles[i].Email.PasswordFile = expandHome(cfg.Profiles[i].Email.PasswordFile)
+		expandWebhooks(cfg.Profiles[i].Webhooks)
+	}
+	return cfg, nil
+}
+
+// expandHome replaces a leading ~/ in path with the user's home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+func expandWebhooks(webhooks []webhook.Config) {
+	for i := range webhooks {
+		webhooks[i].SecretFile = expandHome(webhooks[i].SecretFile)
+	}
+}
+
+// validate checks the config for mistakes, so they are reported at startup.
+func (c *Config) validate() error {
+	var problems []string
+	switch c.Store {
+	case "sqlite":
+		if c.Database == "" {
+			problems = append(problems, "database must be set")
+		}
+	case "json":
+	default:
+		problems = append(problems, fmt.Sprintf("store must be sqlite or json, not %q", c.Store))
+	}
+	if c.StateFile == "" {
+		problems = append(problems, "state_file must be set")
+	}
+	if c.NotifiedFile == "" {
+		problems = append(problems, "notified_file must be set")
+	}
+	if c.OutboxFile == "" {
+		problems = append(problems, "outbox_file must be set")
+	}
+	if c.Backups < 0 {
+		problems = append(problems, fmt.Sprintf("backups must not be negative, not %d", c.Backups))
+	}
+	if c.Interval <= 0 {
+		problems = append(problems, fmt.Sprintf("interval must be positive, not %s", c.Interval))
+	}
+	if c.AlertAfter < 1 {
+		problems = append(problems, fmt.Sprintf("alert_after must be at least 1, not %d", c.AlertAfter))
+	}
+	if c.Workers < 1 {
+		problems = append(problems, fmt.Sprintf("workers must be at least 1, not %d", c.Workers))
+	}
+	if c.HTTP.Timeout <= 0 {
+		problems = append(problems, fmt.Sprintf("http.timeout must be positive, not %s", c.HTTP.Timeout))
+	}
+	if c.HTTP.Attempts < 1 {
+		problems = append(problems, fmt.Sprintf("http.attempts must be at least 1, not %d", c.HTTP.Attempts))
+	}
+	if c.HTTP.Backoff < 0 {
+		problems = append(problems, fmt.Sprintf("http.backoff must not be negative, not %s", c.HTTP.Backoff))
+	}
+	if c.HTTP.PerHost < 0 {
+		problems = append(problems, fmt.Sprintf("http.per_host must not be negative, not %d", c.HTTP.PerHost))
+	}
+	if err := c.Discord.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("discord.%s", err))
+	}
+	if err := c.Slack.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("slack.%s", err))
+	}
+	if err := c.Telegram.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("telegram.%s", err))
+	}
+	if err := c.Email.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("email.%s", err))
+	}
+	for i, wh := range c.Webhooks {
+		if err := wh.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("webhooks[%d]: %s", i, err))
+		}
+	}
+	if len(c.Profiles) == 0 {
+		if len(c.Criteria) == 0 {
+			problems = append(problems, "criteria must contain at least one rule")
+		}
+		if err := c.Criteria.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("criteria: %s", err))
+		}
+		if err := validateChanges(c.Changes); err != nil {
+			problems = append(problems, fmt.Sprintf("changes: %s", err))
+		}
+	}
+	names := make(map[string]bool)
+	for i, p := range c.Profiles {
+		if p.Name == "" {
+			problems = append(problems, fmt.Sprintf("profiles: profile %d has no name", i))
+			continue
+		}
+		if names[p.Name] {
+			problems = append(problems, fmt.Sprintf("profiles: %q is defined twice", p.Name))
+		}
+		names[p.Name] = true
+		if len(p.Criteria) == 0 {
+			problems = append(problems, fmt.Sprintf("profiles.%s.criteria must contain at least one rule", p.Name))
+		}
+		if err := p.Criteria.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("profiles.%s.criteria: %s", p.Name, err))
+		}
+		if err := validateChanges(p.Changes); err != nil {
+			problems = append(problems, fmt.Sprintf("profiles.%s.changes: %s", p.Name, err))
+		}
+		if err := p.Discord.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("profiles.%s.discord.%s", p.Name, err))
+		}
+		if err := p.Slack.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("profiles.%s.slack.%s", p.Name, err))
+		}
+		if err := p.Telegram.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("profiles.%s.telegram.%s", p.Name, err))
+		}
+		if err := p.Email.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("profiles.%s.email.%s", p.Name, err))
+		}
+		for i, wh := range p.Webhooks {
+			if err := wh.Validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("profiles.%s.webhooks[%d]: %s", p.Name, i, err))
+			}
+		}
+	}
+	for name, vc := range c.Vendors {
+		f, ok := slabfinder.LookupFetcher(name)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("vendors: unknown vendor %q, known vendors are %s", name, fetcherNames()))
+			continue
+		}
+		if _, ok := f.(slabfinder.Configurable); !ok && vc.hasSettings() {
+			problems = append(problems, fmt.Sprintf("vendors.%s: only supports \"enabled\"", name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// validateChanges checks that every kind of change is known.
+func validateChanges(kinds []string) error {
+	for _, k := range kinds {
+		known := false
+		for _, ck := range slabfinder.ChangeKinds {
+			known = known || k == ck
+		}
+		if !known {
+			return fmt.Errorf("unknown kind of change %q, known kinds are %s", k, strings.Join(slabfinder.ChangeKinds, ", "))
+		}
+	}
+	return nil
+}
+
+// fetchers configures and returns the enabled fetchers.
+func (c *Config) fetchers() ([]slabfinder.Fetcher, error) {
+	var fetchers []slabfinder.Fetcher
+	for _, f := range slabfinder.Fetchers() {
+		vc, ok := c.Vendors[f.Name()]
+		if !ok {
+			fetchers = append(fetchers, f)
+			continue
+		}
+		if vc.Enabled != nil && !*vc.Enabled {
+			continue
+		}
+		if cf, ok := f.(slabfinder.Configurable); ok && vc.hasSettings() {
+			if err := cf.Configure(vc.node.Decode); err != nil {
+				return nil, fmt.Errorf("vendors.%s: %s", f.Name(), err)
+			}
+		}
+		fetchers = append(fetchers, f)
+	}
+	return fetchers, nil
+}
+
+// enableOnly enables the named fetchers, and disables all the others.
+func (c *Config) enableOnly(names []string) error {
+	enabled := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if _, ok := slabfinder.LookupFetcher(name); !ok {
+			return fmt.Errorf("unknown fetcher %q, known fetchers are %s", name, fetcherNames())
+		}
+		enabled[name] = true
+	}
+	if c.Vendors == nil {
+		c.Vendors = make(map[string]VendorConfig)
+	}
+	for _, f := range slabfinder.Fetchers() {
+		vc := c.Vendors[f.Name()]
+		e := enabled[f.Name()]
+		vc.Enabled = &e
+		c.Vendors[f.Name()] = vc
+	}
+	return nil
+}
+
+// dryRunWebhooks makes every webhook print its requests instead of sending
+// them.
+func (c *Config) dryRunWebhooks() {
+	for i := range c.Webhooks {
+		c.Webhooks[i].DryRun = true
+	}
+	for _, p := range c.Profiles {
+		for i := range p.Webhooks {
+			p.Webhooks[i].DryRun = true
+		}
+	}
+}
+
+// profiles returns the configured profiles, or the default profile.
+func (c *Config) profiles() []Profile {
+	if len(c.Profiles) > 0 {
+		return c.Profiles
+	}
+	return []Profile{{Name: "default", Criteria: c.Criteria, Changes: c.Changes, Discord: c.Discord, Slack: c.Slack, Telegram: c.Telegram, Email: c.Email, Webhooks: c.Webhooks}}
+}
+
+// criteria returns the rules of every profile, a slab which matches any of
+// them is interesting to someone.
+func (c *Config) criteria() criteria.Criteria {
+	var all criteria.Criteria
+	for _, p := range c.profiles() {
+		all = append(all, p.Criteria...)
+	}
+	return all
+}
+
+// notifiers returns a Notifier for each of the profile's configured
+// destinations, by name, eg. "discord" or "webhooks[0]".
+func (p Profile) notifiers() (map[string]notify.Notifier, error) {
+	m := make(map[string]notify.Notifier)
+	hookURL, err := p.Discord.URL()
+	if err != nil {
+		return nil, fmt.Errorf("discord: %s", err)
+	}
+	if hookURL != "" {
+		m["discord"] = discord.New(hookURL)
+	}
+	slackURL, err := p.Slack.URL()
+	if err != nil {
+		return nil, fmt.Errorf("slack: %s", err)
+	}
+	if slackURL != "" {
+		m["slack"] = slack.New(slackURL)
+	}
+	token, err := p.Telegram.BotToken()
+	if err != nil {
+		return nil, fmt.Errorf("telegram: %s", err)
+	}
+	if token != "" {
+		m["telegram"] = telegram.New(p.Telegram, token)
+	}
+	if p.Email.Enabled() {
+		e, err := email.New(p.Email)
+		if err != nil {
+			return nil, fmt.Errorf("email: %s", err)
+		}
+		m["email"] = e
+	}
+	for i, wh := range p.Webhooks {
+		n, err := webhook.New(wh)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks[%d]: %s", i, err)
+		}
+		m[fmt.Sprintf("webhooks[%d]", i)] = n
+	}
+	return m, nil
+}
+
+// alerter returns the Alerter for problems with the watcher itself, or nil if
+// there is nowhere to send them.
+func (c *Config) alerter() (notify.Alerter, error) {
+	var m notify.MultiAlerter
+	hookURL, err := c.Discord.URL()
+	if err != nil {
+		return nil, fmt.Errorf("discord: %s", err)
+	}
+	if hookURL != "" {
+		m = append(m, discord.New(hookURL))
+	}
+	slackURL, err := c.Slack.URL()
+	if err != nil {
+		return nil, fmt.Errorf("slack: %s", err)
+	}
+	if slackURL != "" {
+		m = append(m, slack.New(slackURL))
+	}
+	token, err := c.Telegram.BotToken()
+	if err != nil {
+		return nil, fmt.Errorf("telegram: %s", err)
+	}
+	if token != "" {
+		m = append(m, telegram.New(c.Telegram, token))
+	}
+	if c.Email.Enabled() {
+		e, err := email.New(c.Email)
+		if err != nil {
+			return nil, fmt.Errorf("email: %s", err)
+		}
+		m = append(m, e)
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// openStore opens the configured Store.  An empty database starts with the
+// state in the JSON files, if there is any, so upgrading doesn't lose it.
+func (c *Config) openStore() (store.Store, error) {
+	if c.Store == "json" {
+		return jsonstore.Open(c.StateFile, c.NotifiedFile, c.Backups)
+	}
+	db, err := sqlite.Open(c.Database, c.Backups)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.importJSON(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("importing the JSON state: %s", err)
+	}
+	return db, nil
+}
+
+// importJSON copies the state in the JSON files to db, if it is empty.
+func (c *Config) importJSON(db store.Store) error {
+	slabs, err := db.Slabs()
+	if err != nil {
+		return err
+	}
+	notified, err := db.Notified()
+	if err != nil {
+		return err
+	}
+	if len(slabs) > 0 || len(notified) > 0 {
+		return nil
+	}
+	if _, err := os.Stat(c.StateFile); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	old, err := jsonstore.Open(c.StateFile, c.NotifiedFile, 0)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	n, err := store.Copy(db, old)
+	if err != nil {
+		return err
+	}
+	log.Printf("imported %d known slabs from %s into %s", n, c.StateFile, c.Database)
+	return nil
+}
+
+func fetcherNames() string {
+	var names []string
+	for _, f := range slabfinder.Fetchers() {
+		names = append(names, f.Name())
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+state_file: /var/lib/slabfinder/slabs.json
+interval: 5m
+criteria:
+  - name: island
+    length: {min: 120}
+vendors:
+  ohm:
+    enabled: false
+  stonebasyx:
+    pages:
+      - https://www.stonebasyx.com/live-inventory/product-details/?selproductid=536
+`)
+	cfg, err := loadConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StateFile != "/var/lib/slabfinder/slabs.json" {
+		t.Errorf("got state_file %q", cfg.StateFile)
+	}
+	if cfg.Interval != 5*time.Minute {
+		t.Errorf("got interval %s, want 5m", cfg.Interval)
+	}
+	if len(cfg.Criteria) != 1 || cfg.Criteria[0].Name != "island" {
+		t.Errorf("got criteria %+v, want the island rule", cfg.Criteria)
+	}
+	if cfg.Workers != defaultConfig().Workers {
+		t.Errorf("unset workers was %d, want the default %d", cfg.Workers, defaultConfig().Workers)
+	}
+
+	fetchers, err := cfg.fetchers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range fetchers {
+		names = append(names, f.Name())
+	}
+	if got, want := strings.Join(names, ","), "cosmos,stonebasyx"; got != want {
+		t.Errorf("got enabled fetchers %q, want %q", got, want)
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := loadConfig(missing, false); err != nil {
+		t.Errorf("missing default config: %s", err)
+	}
+	if _, err := loadConfig(missing, true); err == nil {
+		t.Errorf("missing config named by -config was not an error")
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string // a substring of the error
+	}{
+		{
+			name:    "unknown field",
+			content: "intervall: 5m\n",
+			want:    "field intervall not found",
+		},
+		{
+			name:    "bad duration",
+			content: "interval: soon\n",
+			want:    "parsing config",
+		},
+		{
+			name:    "negative interval",
+			content: "interval: -5m\n",
+			want:    "interval must be positive",
+		},
+		{
+			name:    "unknown vendor",
+			content: "vendors:\n  granitecity:\n    enabled: true\n",
+			want:    `unknown vendor "granitecity"`,
+		},
+		{
+			name:    "unconfigurable vendor",
+			content: "vendors:\n  ohm:\n    pages: [https://example.com/]\n",
+			want:    `vendors.ohm: only supports "enabled"`,
+		},
+		{
+			name:    "bad criteria",
+			content: "criteria:\n  - name: island\n    finish: [shiny]\n",
+			want:    `criteria: rule "island": unknown finish: "shiny"`,
+		},
+		{
+			name:    "no criteria",
+			content: "criteria: []\n",
+			want:    "criteria must contain at least one rule",
+		},
+		{
+			name:    "insecure webhook",
+			content: "discord:\n  webhook: http://discord.com/api/webhooks/1\n",
+			want:    "discord.webhook must be an https:// URL",
+		},
+		{
+			name:    "email without recipients",
+			content: "profiles:\n  - name: kitchen\n    criteria:\n      - name: island\n        length: {min: 130}\n    email:\n      host: smtp.example.com\n      from: slabs@example.com\n",
+			want:    "profiles.kitchen.email.to must list at least one address",
+		},
+		{
+			name:    "negative backups",
+			content: "backups: -1\n",
+			want:    "backups must not be negative",
+		},
+		{
+			name:    "unknown store",
+			content: "store: postgres\n",
+			want:    `store must be sqlite or json, not "postgres"`,
+		},
+		{
+			name:    "unknown change",
+			content: "changes: [count_dropped]\n",
+			want:    `changes: unknown kind of change "count_dropped"`,
+		},
+		{
+			name:    "bad webhook template",
+			content: "webhooks:\n  - url: https://ntfy.sh/{{.Profile\n",
+			want:    "webhooks[0]: template: url",
+		},
+	}
+	for _, tc := range tests {
+		cfg, err := loadConfig(writeConfig(t, tc.content), true)
+		if err == nil {
+			err = cfg.validate()
+		}
+		if err == nil {
+			t.Errorf("%s: no error, want %q", tc.name, tc.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %q, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestConfigureFetcherError(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, "vendors:\n  cosmos:\n    pages:\n      - name: Titanium\n        fetch_url: https://www.cosmosgranite.com/getProductDetail\n        finish: Glossy\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.fetchers(); err == nil || !strings.Contains(err.Error(), `unknown finish: "Glossy"`) {
+		t.Errorf("got error %v, want unknown finish", err)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	t.Setenv("HOME", "/home/slabby")
+	tests := map[string]string{
+		"~/slabs.json":    "/home/slabby/slabs.json",
+		"/tmp/slabs.json": "/tmp/slabs.json",
+		"~slabs.json":     "~slabs.json",
+	}
+	for path, want := range tests {
+		if got := expandHome(path); got != want {
+			t.Errorf("expandHome(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -1,144 +1,153 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/gtuk/discordwebhook"
-
 	"github.com/asjoyner/slabfinder"
-	"github.com/asjoyner/slabfinder/fetcher/cosmos"
-	"github.com/asjoyner/slabfinder/fetcher/stonebasyx"
+	"github.com/asjoyner/slabfinder/api"
+	"github.com/asjoyner/slabfinder/dashboard"
+	_ "github.com/asjoyner/slabfinder/fetcher/all"
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
 )
 
-// TODO: Make these flags, default to OS config dir paths
-const (
-	slabFile = "/tmp/slabfinder.slabs.json"
-	hookFile = "/tmp/slabfinder.webhook"
+var (
+	configFile = flag.String("config", filepath.Join(userDir(os.UserConfigDir), "config.yaml"), "path to the config file, it is not an error for the default to be missing")
+
+	// These override the settings in the config file, if they are set.
+	defaults        = defaultConfig()
+	stateFile       = flag.String("state_file", defaults.StateFile, "where to keep the known slabs")
+	webhookFile     = flag.String("webhook_file", defaults.Discord.WebhookFile, "file containing the Discord webhook URL")
+	interval        = flag.Duration("interval", defaults.Interval, "how long to sleep between fetching inventory")
+	enabledFetchers = flag.String("fetchers", "", "comma separated list of fetchers to consult, defaults to all of them")
+	alertAfter      = flag.Int("alert_after", defaults.AlertAfter, "send an alert after a vendor is unreachable for this many consecutive cycles")
+	httpTimeout     = flag.Duration("http_timeout", defaults.HTTP.Timeout, "how long to wait for each request to a vendor")
+	httpAttempts    = flag.Int("http_attempts", defaults.HTTP.Attempts, "how many times to try each request to a vendor")
+	httpBackoff     = flag.Duration("http_backoff", defaults.HTTP.Backoff, "how long to wait before retrying a failed request, doubled for each retry")
+	httpPerHost     = flag.Int("http_per_host", defaults.HTTP.PerHost, "how many concurrent requests to send to each vendor host, 0 is unlimited")
+	workers         = flag.Int("workers", defaults.Workers, "how many vendors to fetch concurrently")
+	listen          = flag.String("listen", defaults.Listen, "the address to serve the dashboard on, eg. localhost:8080, none if empty")
+	webhookDryRun   = flag.Bool("webhook_dry_run", false, "print the requests for the configured webhooks instead of sending them")
+	minLength       = flag.Float64("min_length", 132, "the shortest interesting slab, in inches, replaces the criteria in the config file")
 )
 
 func main() {
-	hb, err := os.ReadFile(hookFile)
+	flag.Parse()
+	cfg, err := configure()
 	if err != nil {
-		log.Printf("reading hookfile: %s", err)
+		log.Print(err)
+		os.Exit(2)
 	}
-	hookURL := strings.TrimSpace(string(hb))
-
-	slabs, err := loadSlabs(slabFile)
-	if err != nil {
-		log.Printf("reading known slabs: %s", err)
-		os.Exit(1)
-	}
-
-	for {
-		watch(slabs, hookURL)
+	if flag.NArg() > 0 {
+		if err := runCommand(cfg, flag.Args(), os.Stdout); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+		return
 	}
-}
-
-// SlabMap is a map from the Slab.ID() to Slab for easy lookup
-type SlabMap map[uint64]slabfinder.Slab
-
-// loadSlabs loads the known slabs from disk, returns a convenient map format
-//
-// TODO: Handle bootstrap condition by checking if the file exists, and
-// accepting an arg to proceed if no file exists
-func loadSlabs(slabFile string) (SlabMap, error) {
-	input, err := os.ReadFile(slabFile)
+	webclient.Default.Policy.Timeout = cfg.HTTP.Timeout
+	webclient.Default.Policy.MaxAttempts = cfg.HTTP.Attempts
+	webclient.Default.Policy.InitialBackoff = cfg.HTTP.Backoff
+	webclient.Default.Policy.MaxPerHost = cfg.HTTP.PerHost
+	fetchers, err := cfg.fetchers()
 	if err != nil {
-		return nil, fmt.Errorf("reading known slabs: %s", err)
-	}
-	var ss []slabfinder.Slab
-	if err := json.Unmarshal(input, &ss); err != nil {
-		return nil, fmt.Errorf("parsing known slabs: %s", err)
+		log.Print(err)
+		os.Exit(2)
 	}
-	slabs := make(SlabMap)
-	for _, slab := range ss {
-		slabs[slab.ID()] = slab // recompute the ID each time, so changing it is less cumbersome
-	}
-	return slabs, nil
-}
 
-func watch(slabs SlabMap, hookURL string) {
-	// Fetch the latest slabs
-	// TODO: generalize this to iterate over all the vendors
-	thisRunTimestamp := time.Now()
-	var ns []slabfinder.Slab
-	s, err := stonebasyx.Fetch()
+	w, err := newWatcher(cfg, fetchers)
 	if err != nil {
-		log.Println(err)
-	}
-	ns = append(ns, s...)
-	s, err = cosmos.Fetch()
-	if err != nil {
-		log.Println(err)
+		log.Print(err)
+		os.Exit(1)
 	}
-	ns = append(ns, s...)
 
-	// include new slabs in the known slabs, update timestamps
-	for _, slab := range ns {
-		if oldSlab, ok := slabs[slab.ID()]; ok {
-			slab.FirstSeen = oldSlab.FirstSeen
-		} else {
-			slab.FirstSeen = thisRunTimestamp
+	if cfg.Listen != "" {
+		l, err := net.Listen("tcp", cfg.Listen)
+		if err != nil {
+			log.Printf("serving the dashboard: %s", err)
+			os.Exit(2)
 		}
-		slab.LastSeen = thisRunTimestamp
-		slabs[slab.ID()] = slab
+		log.Printf("serving the dashboard on http://%s/ and the API on http://%s%s", l.Addr(), l.Addr(), api.Prefix)
+		mux := http.NewServeMux()
+		mux.Handle(api.Prefix, api.New(w.apiSource()))
+		mux.Handle("/", dashboard.New(w.snapshot))
+		go func() {
+			log.Fatalf("serving the dashboard: %s", http.Serve(l, mux))
+		}()
 	}
 
-	// snapshot slabs to disk
-	var wss []slabfinder.Slab
-	for _, s := range slabs {
-		wss = append(wss, s)
+	ctx := context.Background()
+	go w.outbox.Run(ctx, w.deliver, func(err error) {
+		log.Printf("delivering notifications: %s", err)
+	})
+	for {
+		w.cycle(ctx)
+		fmt.Printf("Sleeping for %s.\n", cfg.Interval)
+		time.Sleep(cfg.Interval)
 	}
-	output, err := json.MarshalIndent(wss, "", "	")
+}
+
+// configure loads the config file, applies any flags which were set, and
+// validates the result.
+func configure() (*Config, error) {
+	configSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			configSet = true
+		}
+	})
+	cfg, err := loadConfig(*configFile, configSet)
 	if err != nil {
-		log.Printf("could not marshal slabs: %s", err)
-		os.Exit(3)
-	}
-	if err := ioutil.WriteFile(slabFile, output, 0644); err != nil {
-		log.Printf("writing slabs: %s", err)
-		os.Exit(4)
+		return nil, err
 	}
-
-	// filter slabs by criteria
-	var ourSlabs []slabfinder.Slab
-	for _, slab := range slabs {
-		if slab.Length < 132 {
-			continue
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "state_file":
+			cfg.StateFile = *stateFile
+		case "webhook_file":
+			cfg.Discord.Webhook = ""
+			cfg.Discord.WebhookFile = *webhookFile
+		case "interval":
+			cfg.Interval = *interval
+		case "alert_after":
+			cfg.AlertAfter = *alertAfter
+		case "http_timeout":
+			cfg.HTTP.Timeout = *httpTimeout
+		case "http_attempts":
+			cfg.HTTP.Attempts = *httpAttempts
+		case "http_backoff":
+			cfg.HTTP.Backoff = *httpBackoff
+		case "http_per_host":
+			cfg.HTTP.PerHost = *httpPerHost
+		case "workers":
+			cfg.Workers = *workers
+		case "listen":
+			cfg.Listen = *listen
+		case "min_length":
+			cfg.Criteria = minLengthCriteria(*minLength)
 		}
-		if slab.FirstSeen == slab.LastSeen {
-			fmt.Printf("Interesting new slab: %s\n", slab.String())
+	})
+	if *enabledFetchers != "" {
+		if err := cfg.enableOnly(strings.Split(*enabledFetchers, ",")); err != nil {
+			return nil, err
 		}
-		ourSlabs = append(ourSlabs, slab)
 	}
-
-	// TODO: write HTML page of known interesting slabs?
-
-	// send Discord notification of new interesting slabs
-	if hookURL != "" {
-		discordUsername := "SlabFinder"
-		for _, slab := range ourSlabs {
-			if slab.FirstSeen != slab.LastSeen {
-				continue
-			}
-			content := slab.String()
-			image := discordwebhook.Image{Url: &slab.Photo}
-			embed := discordwebhook.Embed{Image: &image}
-			msg := discordwebhook.Message{
-				Username: &discordUsername,
-				Content:  &content,
-				Embeds:   &[]discordwebhook.Embed{embed},
-			}
-			if err := discordwebhook.SendMessage(hookURL, msg); err != nil {
-				fmt.Println(err)
-			}
-		}
+	if *webhookDryRun {
+		cfg.dryRunWebhooks()
 	}
-	fmt.Println("Sleeping for 15 minutes.")
-	time.Sleep(15 * time.Minute)
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", *configFile, err)
+	}
+	return cfg, nil
 }
+
+// SlabMap is a map from the Slab.ID() to Slab for easy lookup
+type SlabMap map[uint64]slabfinder.Slab
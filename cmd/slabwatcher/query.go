@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asjoyner/slabfinder/store"
+	"github.com/asjoyner/slabfinder/store/jsonstore"
+	"github.com/asjoyner/slabfinder/store/sqlite"
+)
+
+// commands are the subcommands which query the database instead of watching.
+var commands = map[string]func(cfg *Config, args []string, out io.Writer) error{
+	"inventory": inventoryCommand,
+	"stock":     stockCommand,
+	"stats":     statsCommand,
+	"report":    reportCommand,
+}
+
+// runCommand runs the subcommand named by args[0].
+func runCommand(cfg *Config, args []string, out io.Writer) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q, want one of %s", args[0], strings.Join(names, ", "))
+	}
+	return cmd(cfg, args[1:], out)
+}
+
+// openReadOnly opens the store for reading, which can be done while the
+// watcher is running.
+func openReadOnly(cfg *Config) (store.Store, error) {
+	if cfg.Store == "json" {
+		return jsonstore.OpenReadOnly(cfg.StateFile, cfg.NotifiedFile)
+	}
+	return sqlite.OpenReadOnly(cfg.Database)
+}
+
+// openHistory opens the database for queries, which can be made while the
+// watcher is running.
+func openHistory(cfg *Config) (*sqlite.Store, error) {
+	if cfg.Store != "sqlite" {
+		return nil, errors.New("the history is only kept with store: sqlite")
+	}
+	return sqlite.OpenReadOnly(cfg.Database)
+}
+
+// inventoryCommand prints the slabs which were in stock at a point in time.
+func inventoryCommand(cfg *Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("inventory", flag.ContinueOnError)
+	at := flags.String("at", "", "when to list the inventory at, as a date or an RFC 3339 time, defaults to now")
+	vendor := flags.String("vendor", "", "only list this vendor's slabs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	t := time.Now()
+	if *at != "" {
+		var err error
+		if t, err = parseWhen(*at, true); err != nil {
+			return err
+		}
+	}
+	s, err := openHistory(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	slabs, err := s.Inventory(t)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VENDOR\tCOLOR\tFINISH\tTHICKNESS\tLOT\tBUNDLE\tCOUNT\tSIZE\tLOCATION\tLAST SEEN")
+	for _, slab := range slabs {
+		if *vendor != "" && !strings.EqualFold(*vendor, slab.Vendor.String()) {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%vcm\t%s\t%s\t%d\t%vx%v\t%s\t%s\n", slab.Vendor, slab.Color, slab.Finish,
+			slab.Thickness, slab.Lot, slab.Bundle, slab.Count, slab.Length, slab.Width, slab.Location,
+			slab.LastSeen.Local().Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+// stockCommand prints CSV of how much of each color each vendor had in stock
+// in each cycle.
+func stockCommand(cfg *Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("stock", flag.ContinueOnError)
+	fromFlag := flags.String("from", "", "the start of the period, as a date or an RFC 3339 time, defaults to the first cycle")
+	toFlag := flags.String("to", "", "the end of the period, as a date or an RFC 3339 time, defaults to now")
+	vendor := flags.String("vendor", "", "only count this vendor's slabs")
+	color := flags.String("color", "", "only count this color")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var from time.Time
+	to := time.Now()
+	var err error
+	if *fromFlag != "" {
+		if from, err = parseWhen(*fromFlag, false); err != nil {
+			return err
+		}
+	}
+	if *toFlag != "" {
+		if to, err = parseWhen(*toFlag, true); err != nil {
+			return err
+		}
+	}
+	s, err := openHistory(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	stock, err := s.Stock(from, to)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(out)
+	w.Write([]string{"time", "vendor", "color", "bundles", "slabs"})
+	for _, st := range stock {
+		if *vendor != "" && !strings.EqualFold(*vendor, st.Vendor.String()) {
+			continue
+		}
+		if *color != "" && !strings.EqualFold(*color, st.Color) {
+			continue
+		}
+		w.Write([]string{st.Time.Format(time.RFC3339), st.Vendor.String(), st.Color,
+			strconv.Itoa(st.Bundles), strconv.Itoa(st.Slabs)})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// parseWhen parses an RFC 3339 time, or a date in the local time zone, which
+// is the start of the day, or its end if end is set.
+func parseWhen(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (2006-01-02) or an RFC 3339 time", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/analytics"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+func TestQueryCommands(t *testing.T) {
+	cfg := testConfig(t)
+	f := &staticFetcher{slabs: []slabfinder.Slab{
+		{Key: "a", Lot: "a", Color: "Titanium", Count: 3},
+		{Key: "b", Lot: "b", Color: "Titanium", Count: 2},
+	}}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, &notify.Recorder{})
+	cycle(ctx, w)
+	f.slabs = f.slabs[:1]
+	cycle(ctx, w)
+
+	// The commands work while the watcher has the database open.
+	run := func(args ...string) []string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := runCommand(cfg, args, &out); err != nil {
+			t.Fatalf("%v: %s", args, err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		for i, l := range lines {
+			lines[i] = strings.Join(strings.Fields(l), " ")
+		}
+		return lines
+	}
+	stock := run("stock", "-color", "titanium")
+	if len(stock) != 3 {
+		t.Fatalf("stock = %q, want a header and two cycles", stock)
+	}
+	var counts []string
+	for _, l := range stock[1:] {
+		counts = append(counts, l[strings.Index(l, ",")+1:])
+	}
+	if diff := cmp.Diff([]string{"Cosmos,Titanium,2,5", "Cosmos,Titanium,1,3"}, counts); diff != "" {
+		t.Errorf("stock:\n%s", diff)
+	}
+	if got := run("stock", "-vendor", "OHM"); len(got) != 1 {
+		t.Errorf("stock -vendor OHM = %q, want only the header", got)
+	}
+
+	inventory := run("inventory")
+	if len(inventory) != 2 || !strings.HasPrefix(inventory[1], "Cosmos Titanium UnknownPolish 0cm a 3 ") {
+		t.Errorf("inventory = %q, want lot a", inventory)
+	}
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	if got := run("inventory", "-at", yesterday); len(got) != 1 {
+		t.Errorf("inventory -at %s = %q, want only the header", yesterday, got)
+	}
+
+	cfg.Store = "json"
+	if err := runCommand(cfg, []string{"stock"}, &bytes.Buffer{}); err == nil {
+		t.Errorf("stock worked with store: json")
+	}
+	if err := runCommand(cfg, []string{"bogus"}, &bytes.Buffer{}); err == nil {
+		t.Errorf("ran an unknown command")
+	}
+}
+
+func TestParseWhen(t *testing.T) {
+	day := time.Date(2024, 3, 3, 0, 0, 0, 0, time.Local)
+	for _, tc := range []struct {
+		in   string
+		end  bool
+		want time.Time
+	}{
+		{"2024-03-03", false, day},
+		{"2024-03-03", true, day.AddDate(0, 0, 1).Add(-time.Nanosecond)},
+		{"2024-03-03T12:00:00Z", true, time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)},
+	} {
+		got, err := parseWhen(tc.in, tc.end)
+		if err != nil || !got.Equal(tc.want) {
+			t.Errorf("parseWhen(%q, %t) = %s, %v, want %s", tc.in, tc.end, got, err, tc.want)
+		}
+	}
+	if _, err := parseWhen("March 3rd", false); err == nil {
+		t.Errorf("parsed March 3rd")
+	}
+}
+
+func TestStatsCommand(t *testing.T) {
+	for _, st := range []string{"sqlite", "json"} {
+		cfg := testConfig(t)
+		cfg.Store = st
+		f := &staticFetcher{slabs: []slabfinder.Slab{
+			{Key: "a", Lot: "a", Color: "Titanium", Length: 133},
+			{Key: "b", Lot: "b", Color: "Titanium", Length: 120},
+		}}
+		ctx := context.Background()
+		w := testWatcher(t, cfg, f, &notify.Recorder{})
+		cycle(ctx, w)
+		f.slabs = f.slabs[1:]
+		cycle(ctx, w)
+
+		var out bytes.Buffer
+		if err := runCommand(cfg, []string{"stats", "-json"}, &out); err != nil {
+			t.Fatalf("%s: %s", st, err)
+		}
+		var r analytics.Report
+		if err := json.Unmarshal(out.Bytes(), &r); err != nil {
+			t.Fatalf("%s: %s", st, err)
+		}
+		want := []analytics.TimeOnMarket{{Vendor: "Cosmos", Color: "Titanium", Finish: "UnknownPolish", InStock: 1, Gone: 1}}
+		if diff := cmp.Diff(want, r.TimeOnMarket); diff != "" {
+			t.Errorf("%s: time on market:\n%s", st, diff)
+		}
+		if len(r.Sizes) != 1 || r.Sizes[0].Slabs != 1 {
+			t.Errorf("%s: sizes = %+v, want the 133\" slab", st, r.Sizes)
+		}
+
+		out.Reset()
+		if err := runCommand(cfg, []string{"stats"}, &out); err != nil {
+			t.Fatalf("%s: %s", st, err)
+		}
+		if !strings.Contains(out.String(), "Days in stock") {
+			t.Errorf("%s: stats printed %q", st, out.String())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/report"
+	"github.com/asjoyner/slabfinder/store/statefile"
+)
+
+// newReport returns the report of the slabs which match any profile.
+func newReport(cfg *Config, slabs map[uint64]slabfinder.Slab, now time.Time) *report.Report {
+	var list []slabfinder.Slab
+	for _, s := range slabs {
+		list = append(list, s)
+	}
+	return report.New(list, cfg.criteria(), now)
+}
+
+// writeReports writes the report of the interesting slabs to the files in rc,
+// replacing each atomically, so a web server never serves half of one.
+func writeReports(cfg *Config, rc ReportConfig, slabs map[uint64]slabfinder.Slab, now time.Time) error {
+	if rc.HTML == "" && rc.Markdown == "" {
+		return nil
+	}
+	r := newReport(cfg, slabs, now)
+	for _, f := range []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{rc.HTML, r.HTML},
+		{rc.Markdown, r.Markdown},
+	} {
+		if f.path == "" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := f.write(&buf); err != nil {
+			return fmt.Errorf("rendering %s: %s", f.path, err)
+		}
+		// The reports are meant to be published, eg. by a web server.
+		if err := statefile.WriteFileMode(f.path, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("writing %s: %s", f.path, err)
+		}
+	}
+	return nil
+}
+
+// reportCommand writes the report once, to the files in the config or given
+// by flags, or as HTML to out if there are none.
+func reportCommand(cfg *Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	html := flags.String("html", cfg.Report.HTML, "where to write the HTML report")
+	markdown := flags.String("markdown", cfg.Report.Markdown, "where to write the Markdown report")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	s, err := openReadOnly(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	slabs, err := s.Slabs()
+	if err != nil {
+		return err
+	}
+	rc := ReportConfig{HTML: expandHome(*html), Markdown: expandHome(*markdown)}
+	if rc.HTML == "" && rc.Markdown == "" {
+		return newReport(cfg, slabs, time.Now()).HTML(out)
+	}
+	return writeReports(cfg, rc, slabs, time.Now())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+func TestReports(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)})
+	dir := t.TempDir()
+	cfg.Report = ReportConfig{HTML: filepath.Join(dir, "slabs.html"), Markdown: filepath.Join(dir, "slabs.md")}
+	f := &staticFetcher{slabs: []slabfinder.Slab{
+		{Key: "a", Lot: "long", Color: "Titanium", Length: 132},
+		{Key: "b", Lot: "short", Color: "Titanium", Length: 100},
+	}}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, &notify.Recorder{})
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// The reports are written after each cycle.
+	cycle(ctx, w)
+	for _, path := range []string{cfg.Report.HTML, cfg.Report.Markdown} {
+		if got := read(path); !strings.Contains(got, "long") || strings.Contains(got, "short") {
+			t.Errorf("%s doesn't list only the long slab:\n%s", path, got)
+		}
+		if fi, err := os.Stat(path); err != nil {
+			t.Error(err)
+		} else if fi.Mode().Perm() != 0644 {
+			t.Errorf("%s has mode %v, want 0644", path, fi.Mode().Perm())
+		}
+	}
+	f.slabs = f.slabs[1:]
+	cycle(ctx, w)
+	if got := read(cfg.Report.HTML); !strings.Contains(got, "No slabs match.") {
+		t.Errorf("the report still lists the gone slab:\n%s", got)
+	}
+
+	// The command writes HTML while the watcher is running.
+	f.slabs = []slabfinder.Slab{{Key: "a", Lot: "long", Color: "Titanium", Length: 132}}
+	cycle(ctx, w)
+	cfg.Report = ReportConfig{}
+	var out bytes.Buffer
+	if err := runCommand(cfg, []string{"report"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "<h2>Titanium at Cosmos</h2>") {
+		t.Errorf("report printed:\n%s", out.String())
+	}
+}
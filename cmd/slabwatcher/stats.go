@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/analytics"
+)
+
+// statsCommand prints how long slabs stay in stock, when vendors restock, and
+// how many long slabs arrive, as tables or JSON.
+func statsCommand(cfg *Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print JSON instead of tables")
+	minLength := flags.Float64("min_length", 132, "the shortest slab in the size distribution, in inches")
+	bin := flags.Float64("bin", 6, "the range of lengths in each row of the size distribution, in inches")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	s, err := openReadOnly(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	known, err := s.Slabs()
+	if err != nil {
+		return err
+	}
+	var slabs []slabfinder.Slab
+	for _, slab := range known {
+		slabs = append(slabs, slab)
+	}
+	r := analytics.Analyze(slabs, analytics.Options{Now: time.Now(), MinLength: *minLength, BinWidth: *bin})
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "	")
+		return enc.Encode(r)
+	}
+	return printReport(out, r)
+}
+
+// printReport prints the Report as tables.
+func printReport(out io.Writer, r analytics.Report) error {
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Days in stock, of the slabs which are gone:")
+	fmt.Fprintln(tw, "VENDOR\tCOLOR\tFINISH\tIN STOCK\tGONE\tMEDIAN DAYS")
+	for _, t := range r.TimeOnMarket {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", t.Vendor, t.Color, t.Finish, t.InStock, t.Gone, days(t.Gone, t.MedianDays))
+	}
+
+	fmt.Fprintln(tw, "\nRestocks, since each vendor was first fetched:")
+	fmt.Fprintln(tw, "VENDOR\tCOLOR\tRESTOCKS\tNEW SLABS\tDAYS BETWEEN\tLAST")
+	for _, r := range r.Restocks {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", r.Vendor, r.Color, r.Restocks, r.NewSlabs,
+			days(r.Restocks-1, r.MeanDaysBetween), r.Last.Format("2006-01-02"))
+	}
+
+	fmt.Fprintln(tw, "\nNew slabs by day of the week:")
+	fmt.Fprint(tw, "VENDOR")
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		fmt.Fprintf(tw, "\t%s", d.String()[:3])
+	}
+	fmt.Fprintln(tw, "\tTYPICAL")
+	for _, w := range r.Weekdays {
+		fmt.Fprint(tw, w.Vendor)
+		for _, n := range w.Counts {
+			fmt.Fprintf(tw, "\t%d", n)
+		}
+		fmt.Fprintf(tw, "\t%s\n", w.Typical)
+	}
+
+	fmt.Fprintf(tw, "\nSlabs at least %v\" long, by the month they were first seen:\n", r.MinLength)
+	fmt.Fprintln(tw, "MONTH\tLENGTH\tSLABS\tGONE\tMEDIAN DAYS")
+	for _, s := range r.Sizes {
+		fmt.Fprintf(tw, "%s\t%v-%v\"\t%d\t%d\t%s\n", s.Month, s.MinLength, s.MaxLength, s.Slabs, s.Gone, days(s.Gone, s.MedianDays))
+	}
+	return tw.Flush()
+}
+
+// days formats a number of days, or "-" if it is based on no slabs.
+func days(n int, d float64) string {
+	if n <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", d)
+}
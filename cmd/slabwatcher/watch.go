@@ -0,0 +1,606 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/api"
+	"github.com/asjoyner/slabfinder/notify"
+	"github.com/asjoyner/slabfinder/notify/outbox"
+	"github.com/asjoyner/slabfinder/store"
+)
+
+// watcher holds the state carried from one fetch cycle to the next.
+type watcher struct {
+	cfg      *Config
+	fetchers []slabfinder.Fetcher
+	store    store.Store
+	// mu guards slabs, vendors and events, which the dashboard and API read
+	// while cycles change them
+	mu       sync.RWMutex
+	slabs    SlabMap
+	vendors  map[string]api.Vendor // the last fetch by each fetcher
+	events   []api.Event           // the latest maxEvents, oldest first
+	profiles []*profile
+	notified store.Notified
+	outbox   *outbox.Outbox
+	alerter  notify.Alerter // for problems with the watcher itself, may be nil
+
+	// unreachableCycles counts how many consecutive cycles each fetcher
+	// failed to retrieve any pages, by fetcher name.
+	unreachableCycles map[string]int
+}
+
+// profile is a configured Profile, with a Notifier for each destination.
+type profile struct {
+	Profile
+	notifiers map[string]notify.Notifier
+}
+
+// newWatcher loads the state described by cfg.
+func newWatcher(cfg *Config, fetchers []slabfinder.Fetcher) (*watcher, error) {
+	w := &watcher{
+		cfg:               cfg,
+		fetchers:          fetchers,
+		vendors:           make(map[string]api.Vendor),
+		unreachableCycles: make(map[string]int),
+	}
+	var err error
+	if w.alerter, err = cfg.alerter(); err != nil {
+		return nil, err
+	}
+	for _, p := range cfg.profiles() {
+		n, err := p.notifiers()
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %s", p.Name, err)
+		}
+		w.profiles = append(w.profiles, &profile{p, n})
+	}
+	if w.store, err = cfg.openStore(); err != nil {
+		return nil, err
+	}
+	if w.slabs, err = w.store.Slabs(); err != nil {
+		w.store.Close()
+		return nil, err
+	}
+	if w.notified, err = w.store.Notified(); err != nil {
+		w.store.Close()
+		return nil, err
+	}
+	if w.outbox, err = outbox.Open(cfg.OutboxFile); err != nil {
+		w.store.Close()
+		return nil, err
+	}
+	w.events = trimEvents(api.SlabEvents(w.slabs))
+	return w, nil
+}
+
+// close releases the store, so another watcher can use it.
+func (w *watcher) close() error {
+	return w.store.Close()
+}
+
+// snapshot returns a copy of the known slabs, for the dashboard.
+func (w *watcher) snapshot() map[uint64]slabfinder.Slab {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	slabs := make(map[uint64]slabfinder.Slab, len(w.slabs))
+	for id, s := range w.slabs {
+		slabs[id] = s
+	}
+	return slabs
+}
+
+// apiSource returns the state served by the API.
+func (w *watcher) apiSource() api.Source {
+	return api.Source{Slabs: w.snapshot, Vendors: w.vendorStatus, Events: w.eventsSince}
+}
+
+// vendorStatus returns the last fetch by each fetcher, by name.
+func (w *watcher) vendorStatus() []api.Vendor {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var vendors []api.Vendor
+	for _, v := range w.vendors {
+		vendors = append(vendors, v)
+	}
+	sort.Slice(vendors, func(i, j int) bool { return vendors[i].Fetcher < vendors[j].Fetcher })
+	return vendors
+}
+
+// eventsSince returns a copy of the kept events after since.
+func (w *watcher) eventsSince(since time.Time) []api.Event {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	i := sort.Search(len(w.events), func(i int) bool { return w.events[i].Time.After(since) })
+	return append([]api.Event(nil), w.events[i:]...)
+}
+
+// maxEvents is how many events are kept for the API.
+const maxEvents = 10000
+
+// trimEvents returns the latest maxEvents.
+func trimEvents(events []api.Event) []api.Event {
+	if len(events) <= maxEvents {
+		return events
+	}
+	return append([]api.Event(nil), events[len(events)-maxEvents:]...)
+}
+
+// record keeps the outcome of each fetch, and what happened to the slabs in
+// the cycle, for the API.
+func (w *watcher) record(results slabfinder.FetchResults, u updates, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, r := range results {
+		v := api.Vendor{
+			Fetcher:    r.Fetcher,
+			Vendor:     r.Vendor.String(),
+			LastFetch:  now,
+			Slabs:      len(r.Slabs),
+			DurationMS: r.Duration.Milliseconds(),
+		}
+		if r.Err != nil {
+			v.Error = r.Err.Error()
+			v.LastSuccess = w.vendors[r.Fetcher].LastSuccess
+		} else {
+			t := now
+			v.LastSuccess = &t
+		}
+		w.vendors[r.Fetcher] = v
+	}
+
+	var events []api.Event
+	add := func(t notify.EventType, id uint64, changes []slabfinder.Change) {
+		events = append(events, api.NewEvent(now, t, w.slabs[id], changes))
+	}
+	for id, s := range w.slabs {
+		if s.FirstSeen.Equal(now) {
+			add(notify.New, id, nil)
+		}
+	}
+	for id, changes := range u.changed {
+		add(notify.Changed, id, changes)
+	}
+	for _, id := range u.gone {
+		add(notify.Gone, id, nil)
+	}
+	for _, id := range u.returned {
+		add(notify.Returned, id, nil)
+	}
+	api.SortEvents(events)
+	w.events = trimEvents(append(w.events, events...))
+}
+
+// cycle fetches the latest slabs, records them, and queues notifications for
+// each profile of the slabs which newly match its criteria.  They are
+// delivered from the outbox by a separate worker.
+func (w *watcher) cycle(ctx context.Context) {
+	// Fetch the latest slabs
+	thisRunTimestamp := time.Now()
+	results := slabfinder.FetchAll(ctx, w.fetchers, w.cfg.Workers)
+	for _, r := range results {
+		log.Printf("%s: fetched %d slabs in %s", r.Fetcher, len(r.Slabs), r.Duration.Round(time.Millisecond))
+		if r.Err != nil {
+			log.Printf("%s: %s", r.Fetcher, r.Err)
+		}
+		if slabfinder.Unreachable(r.Err) {
+			w.unreachableCycles[r.Fetcher]++
+			if w.unreachableCycles[r.Fetcher] == w.cfg.AlertAfter {
+				w.alert(ctx, fmt.Sprintf("%s has been unreachable for %d cycles: %s", r.Fetcher, w.cfg.AlertAfter, r.Err))
+			}
+		} else {
+			w.unreachableCycles[r.Fetcher] = 0
+		}
+	}
+	u := w.merge(results, thisRunTimestamp)
+	w.record(results, u, thisRunTimestamp)
+
+	// Queue notifications of the slabs which newly match each profile's
+	// criteria, before recording that they were sent, so they can't be lost.
+	entries := w.queue(u, thisRunTimestamp)
+	if err := w.outbox.Add(entries...); err != nil {
+		log.Print(err)
+		os.Exit(4)
+	}
+	if err := w.save(results, u, thisRunTimestamp); err != nil {
+		log.Printf("saving state: %s", err)
+		os.Exit(4)
+	}
+	if err := writeReports(w.cfg, w.cfg.Report, w.slabs, thisRunTimestamp); err != nil {
+		log.Printf("writing the report: %s", err)
+	}
+}
+
+// queue returns the outbox entries for each profile's events in the cycle,
+// and records the profiles as notified about their new matches.
+func (w *watcher) queue(u updates, now time.Time) []outbox.Entry {
+	var entries []outbox.Entry
+	for _, p := range w.profiles {
+		events := w.updateEvents(p, u)
+		events = append(events, w.newMatches(p, u, now)...)
+		if len(events) == 0 {
+			continue
+		}
+		for _, e := range events {
+			fmt.Printf("%s: %s\n", p.Name, e.String())
+		}
+		var dests []string
+		for dest := range p.notifiers {
+			dests = append(dests, dest)
+		}
+		sort.Strings(dests)
+		for _, dest := range dests {
+			entries = append(entries, outbox.Entry{
+				ID:          fmt.Sprintf("%s/%s/%d", p.Name, dest, now.UnixNano()),
+				Profile:     p.Name,
+				Destination: dest,
+				Events:      events,
+			})
+		}
+	}
+	return entries
+}
+
+// save records the cycle in the store, in one transaction: the slabs which
+// were fetched or are newly gone, and the new notifications.
+func (w *watcher) save(results slabfinder.FetchResults, u updates, now time.Time) error {
+	run := store.Run{Time: now}
+	for _, r := range results {
+		v := store.VendorStatus{Fetcher: r.Fetcher, Vendor: r.Vendor, Slabs: len(r.Slabs), Duration: r.Duration}
+		if r.Err != nil {
+			v.Err = r.Err.Error()
+		}
+		run.Vendors = append(run.Vendors, v)
+	}
+	tx, err := w.store.Begin(run)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rekeyed := make(map[uint64]bool)
+	for legacy, id := range u.rekeyed {
+		if err := tx.DeleteSlab(legacy); err != nil {
+			return err
+		}
+		rekeyed[id] = true
+	}
+	stale := make(map[uint64]bool)
+	for _, id := range u.stale {
+		stale[id] = true
+	}
+	for id, slab := range w.slabs {
+		seen := slab.LastSeen.Equal(now)
+		if !seen && !slab.Gone.Equal(now) && !stale[id] {
+			continue
+		}
+		if err := tx.PutSlab(id, slab); err != nil {
+			return err
+		}
+		if seen {
+			if err := tx.Observe(id, slab); err != nil {
+				return err
+			}
+		}
+	}
+	for profile, ids := range w.notified {
+		for id, t := range ids {
+			if !t.Equal(now) && !rekeyed[id] {
+				continue
+			}
+			if err := tx.Notify(profile, id, t); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// updates are what happened to the known slabs in a cycle, by Slab.ID().
+type updates struct {
+	gone     []uint64
+	returned []uint64
+	changed  map[uint64][]slabfinder.Change
+	rekeyed  map[uint64]uint64 // the new ID of each LegacyID which was moved
+	// lastSeen is when each changed, gone or returned slab was last seen
+	// before the cycle, which identifies its events in outbox.Key
+	lastSeen map[uint64]time.Time
+	// arrived is the slabs first seen in the cycle from vendors which had
+	// been fetched before, so they are new arrivals rather than the
+	// vendor's existing inventory
+	arrived map[uint64]bool
+	// stale is the slabs recorded by older versions which had already gone
+	// before the cycle, so they are marked gone when they were last seen,
+	// and not notified
+	stale []uint64
+}
+
+// maxHistory is how many changes are kept for each slab.
+const maxHistory = 100
+
+// merge records the fetched slabs in the known slabs, with the changes to
+// their fields, and returns what happened to them.  A slab is only Gone if it
+// is missing from a successful fetch of the page which listed it, so a page
+// or vendor being unreachable, or listing nothing, doesn't look like it sold
+// everything.
+func (w *watcher) merge(results slabfinder.FetchResults, now time.Time) updates {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	u := updates{changed: make(map[uint64][]slabfinder.Change), rekeyed: make(map[uint64]uint64), lastSeen: make(map[uint64]time.Time), arrived: make(map[uint64]bool)}
+	known := make(map[slabfinder.Vendor]bool)
+	previous := make(map[slabfinder.Vendor]time.Time) // each vendor's previous listing
+	for _, slab := range w.slabs {
+		known[slab.Vendor] = true
+		if slab.LastSeen.After(previous[slab.Vendor]) {
+			previous[slab.Vendor] = slab.LastSeen
+		}
+	}
+	ids, slabs := fetched(results)
+	seen := make(map[uint64]bool)
+	for _, id := range ids {
+		slab := slabs[id]
+		seen[id] = true
+		if _, ok := w.slabs[id]; !ok && slab.Key != "" {
+			for _, legacy := range legacyIDs(slab) {
+				if w.rekey(legacy, id) {
+					u.rekeyed[legacy] = id
+					break
+				}
+			}
+		}
+		if oldSlab, ok := w.slabs[id]; ok {
+			slab.FirstSeen = oldSlab.FirstSeen
+			slab.History = oldSlab.History
+			if changes := slabfinder.Diff(oldSlab, slab, now); len(changes) > 0 {
+				u.changed[id] = changes
+				u.lastSeen[id] = oldSlab.LastSeen
+				slab.History = append(slab.History, changes...)
+				if len(slab.History) > maxHistory {
+					slab.History = slab.History[len(slab.History)-maxHistory:]
+				}
+			}
+			if !oldSlab.Gone.IsZero() {
+				u.returned = append(u.returned, id)
+				u.lastSeen[id] = oldSlab.LastSeen
+			}
+		} else {
+			slab.FirstSeen = now
+			u.arrived[id] = known[slab.Vendor]
+		}
+		slab.LastSeen = now
+		w.slabs[id] = slab
+	}
+	if len(u.rekeyed) > 0 {
+		log.Printf("moved %d known slabs to version %d IDs", len(u.rekeyed), slabfinder.IDVersion)
+	}
+	fetchErrs := make(map[slabfinder.Vendor]error)
+	for _, r := range results {
+		// A vendor listing nothing is more likely to be broken than to
+		// have sold everything.
+		if len(r.Slabs) > 0 {
+			fetchErrs[r.Vendor] = r.Err
+		}
+	}
+	for id, slab := range w.slabs {
+		err, ok := fetchErrs[slab.Vendor]
+		if seen[id] || !slab.Gone.IsZero() || !ok || !pageFetched(slab, err) {
+			continue
+		}
+		if slab.Page == "" && slab.LastSeen.Before(previous[slab.Vendor]) {
+			slab.Gone = slab.LastSeen
+			w.slabs[id] = slab
+			u.stale = append(u.stale, id)
+			continue
+		}
+		slab.Gone = now
+		w.slabs[id] = slab
+		u.gone = append(u.gone, id)
+		u.lastSeen[id] = slab.LastSeen
+	}
+	return u
+}
+
+// pageFetched reports whether the page which listed the slab was fetched,
+// given its vendor's fetch error, so the slab being missing means it is
+// gone.  Slabs recorded before their Page was are only gone if every page
+// was fetched.
+func pageFetched(slab slabfinder.Slab, err error) bool {
+	if err == nil {
+		return true
+	}
+	var fe *slabfinder.FetchError
+	if slab.Page == "" || !errors.As(err, &fe) || fe.Unreachable() {
+		return false
+	}
+	return !fe.Failed(slab.Page)
+}
+
+// fetched returns the fetched slabs by ID, and their IDs in the order they
+// were fetched.  A vendor may list a slab more than once, so each ID is only
+// compared with the known slabs once: the rows' counts are added up, and the
+// rest of the slab is the first row.
+func fetched(results slabfinder.FetchResults) ([]uint64, map[uint64]slabfinder.Slab) {
+	var ids []uint64
+	slabs := make(map[uint64]slabfinder.Slab)
+	for _, slab := range results.Slabs() {
+		id := slab.ID()
+		if s, ok := slabs[id]; ok {
+			s.Count += slab.Count
+			slabs[id] = s
+			continue
+		}
+		ids = append(ids, id)
+		slabs[id] = slab
+	}
+	return ids, slabs
+}
+
+// legacyIDs returns the IDs older versions may have recorded the slab under:
+// its LegacyID, or its LegacyID without the Location, which they didn't
+// record for StoneBasyx slabs.
+func legacyIDs(slab slabfinder.Slab) []uint64 {
+	ids := []uint64{slab.LegacyID()}
+	if slab.Location != "" {
+		slab.Location = ""
+		ids = append(ids, slab.LegacyID())
+	}
+	return ids
+}
+
+// rekey moves a slab recorded before its vendor supplied a Key from its
+// LegacyID to its new ID, along with the record of which profiles were
+// notified about it.  It reports whether there was such a slab.
+func (w *watcher) rekey(legacy, id uint64) bool {
+	slab, ok := w.slabs[legacy]
+	if !ok || slab.Key != "" {
+		return false
+	}
+	delete(w.slabs, legacy)
+	w.slabs[id] = slab
+	for _, notified := range w.notified {
+		if t, ok := notified[legacy]; ok {
+			delete(notified, legacy)
+			notified[id] = t
+		}
+	}
+	return true
+}
+
+// updateEvents returns Gone, Returned and Changed events for the slabs which
+// the profile has been notified about.  Changed events only include the
+// kinds of change the profile asked for.
+func (w *watcher) updateEvents(p *profile, u updates) []notify.Event {
+	notified := w.notified[p.Name]
+	kinds := make(map[string]bool)
+	for _, k := range p.Changes {
+		kinds[k] = true
+	}
+	var events []notify.Event
+	add := func(t notify.EventType, id uint64, changes []slabfinder.Change) {
+		slab := w.slabs[id]
+		rule, _ := p.Criteria.Match(slab)
+		e := notify.Event{Type: t, Profile: p.Name, Rule: rule, Slab: slab, Changes: changes}
+		e.Key = outbox.Key(e, u.lastSeen[id])
+		events = append(events, e)
+	}
+	for _, id := range u.gone {
+		if _, ok := notified[id]; ok {
+			add(notify.Gone, id, nil)
+		}
+	}
+	for _, id := range u.returned {
+		if _, ok := notified[id]; ok {
+			add(notify.Returned, id, nil)
+		}
+	}
+	for id, changes := range u.changed {
+		if _, ok := notified[id]; !ok {
+			continue
+		}
+		var wanted []slabfinder.Change
+		for _, c := range changes {
+			if kinds[c.Kind] {
+				wanted = append(wanted, c)
+			}
+		}
+		if len(wanted) > 0 {
+			add(notify.Changed, id, wanted)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Type != events[j].Type {
+			return events[i].Type < events[j].Type
+		}
+		return lessSlab(events[i].Slab, events[j].Slab)
+	})
+	return events
+}
+
+// deliver sends an outbox entry to its destination.  Entries for a profile or
+// destination which is no longer configured are dropped.
+func (w *watcher) deliver(ctx context.Context, e outbox.Entry) error {
+	for _, p := range w.profiles {
+		if p.Name != e.Profile {
+			continue
+		}
+		if n, ok := p.notifiers[e.Destination]; ok {
+			return n.Notify(ctx, e.Events)
+		}
+	}
+	log.Printf("dropping notification %s: %s of profile %s is no longer configured", e.ID, e.Destination, e.Profile)
+	return nil
+}
+
+// alert logs a problem with the watcher itself, and sends it to the alerter
+func (w *watcher) alert(ctx context.Context, message string) {
+	log.Print(message)
+	if w.alerter == nil {
+		return
+	}
+	if err := w.alerter.Alert(ctx, message); err != nil {
+		log.Printf("sending alert: %s", err)
+	}
+}
+
+// newMatches returns New events for the slabs seen at the given time which
+// match the profile's criteria, and which the profile has not been notified
+// about.
+// They are recorded as notified.  The first time a profile is seen, all its
+// matches are recorded, but only the slabs which just arrived are returned,
+// so a new profile does not receive notifications for the whole inventory.
+func (w *watcher) newMatches(p *profile, u updates, seen time.Time) []notify.Event {
+	notified, ok := w.notified[p.Name]
+	bootstrap := !ok
+	if bootstrap {
+		notified = make(map[uint64]time.Time)
+		w.notified[p.Name] = notified
+	}
+	var events []notify.Event
+	for id, slab := range w.slabs {
+		if !slab.LastSeen.Equal(seen) {
+			continue // no longer in stock
+		}
+		if _, ok := notified[id]; ok {
+			continue
+		}
+		rule, ok := p.Criteria.Match(slab)
+		if !ok {
+			continue
+		}
+		notified[id] = seen
+		if !bootstrap || u.arrived[id] {
+			e := notify.Event{Type: notify.New, Profile: p.Name, Rule: rule, Slab: slab}
+			e.Key = outbox.Key(e, time.Time{})
+			events = append(events, e)
+		}
+	}
+	if bootstrap {
+		log.Printf("new profile %s: recorded %d existing matches without notifying", p.Name, len(notified)-len(events))
+	}
+	sort.Slice(events, func(i, j int) bool { return lessSlab(events[i].Slab, events[j].Slab) })
+	return events
+}
+
+// lessSlab orders slabs by vendor, then color, lot, bundle and location.
+func lessSlab(a, b slabfinder.Slab) bool {
+	if a.Vendor != b.Vendor {
+		return a.Vendor < b.Vendor
+	}
+	if a.Color != b.Color {
+		return a.Color < b.Color
+	}
+	if a.Lot != b.Lot {
+		return a.Lot < b.Lot
+	}
+	if a.Bundle != b.Bundle {
+		return a.Bundle < b.Bundle
+	}
+	return a.Location < b.Location
+}
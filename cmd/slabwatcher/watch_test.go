@@ -0,0 +1,612 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/criteria"
+	"github.com/asjoyner/slabfinder/dashboard"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// staticFetcher returns whatever slabs and error it currently holds.
+type staticFetcher struct {
+	slabs []slabfinder.Slab
+	err   error
+}
+
+func (f *staticFetcher) Name() string              { return "static" }
+func (f *staticFetcher) Vendor() slabfinder.Vendor { return slabfinder.Cosmos }
+func (f *staticFetcher) Fetch(ctx context.Context) ([]slabfinder.Slab, error) {
+	var slabs []slabfinder.Slab
+	for _, s := range f.slabs {
+		s.Vendor = f.Vendor()
+		slabs = append(slabs, s)
+	}
+	return slabs, f.err
+}
+
+func lengthRule(name string, min, max float64) criteria.Criteria {
+	return criteria.Criteria{{
+		Name:      name,
+		Condition: criteria.Condition{Length: &criteria.Range{Min: &min, Max: &max}},
+	}}
+}
+
+func testConfig(t *testing.T, profiles ...Profile) *Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.Database = filepath.Join(dir, "slabs.db")
+	cfg.StateFile = filepath.Join(dir, "slabs.json")
+	cfg.NotifiedFile = filepath.Join(dir, "notified.json")
+	cfg.OutboxFile = filepath.Join(dir, "outbox.json")
+	cfg.Discord.WebhookFile = ""
+	cfg.Profiles = profiles
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// testWatcher returns a watcher whose profiles and alerts all notify n.
+func testWatcher(t *testing.T, cfg *Config, f slabfinder.Fetcher, n interface {
+	notify.Notifier
+	notify.Alerter
+}) *watcher {
+	t.Helper()
+	w, err := newWatcher(cfg, []slabfinder.Fetcher{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.close() })
+	for _, p := range w.profiles {
+		p.notifiers = map[string]notify.Notifier{"test": n}
+	}
+	w.alerter = n
+	return w
+}
+
+// cycle runs a cycle, and delivers the notifications it queued.
+func cycle(ctx context.Context, w *watcher) error {
+	w.cycle(ctx)
+	return w.outbox.Deliver(ctx, w.deliver)
+}
+
+// failingNotifier fails to deliver anything.
+type failingNotifier struct {
+	notify.Recorder
+}
+
+func (f *failingNotifier) Notify(ctx context.Context, events []notify.Event) error {
+	return errors.New("connection refused")
+}
+
+// sentLots summarizes the recorded events as the lots sent to each profile.
+func sentLots(rec *notify.Recorder) map[string][]string {
+	lots := make(map[string][]string)
+	for _, e := range rec.Events() {
+		lots[e.Profile] = append(lots[e.Profile], e.Type.String()+" "+e.Slab.Lot)
+	}
+	for _, l := range lots {
+		sort.Strings(l)
+	}
+	return lots
+}
+
+// slabIDs returns the IDs of the known slabs, in order.
+func slabIDs(slabs SlabMap) []uint64 {
+	var ids []uint64
+	for id := range slabs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestProfiles(t *testing.T) {
+	kitchen := Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)}
+	vanity := Profile{Name: "vanity", Criteria: lengthRule("remnant", 0, 72)}
+	everything := Profile{Name: "everything", Criteria: lengthRule("any", 0, 200)}
+	cfg := testConfig(t, kitchen, vanity)
+	f := &staticFetcher{}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+
+	// The first cycle records the existing inventory without notifying.
+	f.slabs = []slabfinder.Slab{{Lot: "long", Length: 132}, {Lot: "short", Length: 60}}
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("first cycle notified: %v", got)
+	}
+
+	// New slabs are sent to each matching profile, once.
+	f.slabs = append(f.slabs, slabfinder.Slab{Lot: "long2", Length: 131}, slabfinder.Slab{Lot: "tiny", Length: 30})
+	cycle(ctx, w)
+	want := map[string][]string{"kitchen": {"New long2"}, "vanity": {"New tiny"}}
+	if diff := cmp.Diff(want, sentLots(rec)); diff != "" {
+		t.Errorf("second cycle:\n%s", diff)
+	}
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("third cycle repeated notifications: %v", got)
+	}
+
+	// Adding a profile, and restarting, doesn't resend old matches to anyone,
+	// but a slab which arrives meanwhile is new to the added profile too.
+	cfg.Profiles = append(cfg.Profiles, everything)
+	w.close()
+	w = testWatcher(t, cfg, f, rec)
+	f.slabs = append(f.slabs, slabfinder.Slab{Lot: "long4", Length: 133})
+	cycle(ctx, w)
+	want = map[string][]string{"kitchen": {"New long4"}, "everything": {"New long4"}}
+	if diff := cmp.Diff(want, sentLots(rec)); diff != "" {
+		t.Errorf("cycle after adding a profile:\n%s", diff)
+	}
+
+	// A slab which matches two profiles is sent to both.
+	f.slabs = append(f.slabs, slabfinder.Slab{Lot: "long3", Length: 140})
+	cycle(ctx, w)
+	want = map[string][]string{"kitchen": {"New long3"}, "everything": {"New long3"}}
+	if diff := cmp.Diff(want, sentLots(rec)); diff != "" {
+		t.Errorf("cycle after adding long3:\n%s", diff)
+	}
+}
+
+func TestGoneAndReturned(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)})
+	f := &staticFetcher{}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+	long := slabfinder.Slab{Lot: "long", Length: 132}
+	short := slabfinder.Slab{Lot: "short", Length: 60}
+	other := slabfinder.Slab{Lot: "other", Length: 60}
+	f.slabs = []slabfinder.Slab{other}
+	cycle(ctx, w)
+	f.slabs = []slabfinder.Slab{long, short, other}
+	cycle(ctx, w)
+	if diff := cmp.Diff(map[string][]string{"kitchen": {"New long"}}, sentLots(rec)); diff != "" {
+		t.Errorf("new slab:\n%s", diff)
+	}
+
+	// Nothing is gone if the vendor couldn't be fetched, or listed nothing.
+	f.slabs, f.err = nil, errors.New("connection refused")
+	cycle(ctx, w)
+	f.err = nil
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("failed fetch notified: %v", got)
+	}
+
+	// Both slabs are gone, but the profile only watched one of them.
+	f.slabs = []slabfinder.Slab{other}
+	cycle(ctx, w)
+	if diff := cmp.Diff(map[string][]string{"kitchen": {"Gone long"}}, sentLots(rec)); diff != "" {
+		t.Errorf("gone slab:\n%s", diff)
+	}
+	for _, s := range w.slabs {
+		if s.Gone.IsZero() != (s.Lot == "other") {
+			t.Errorf("%s is marked gone at %v", s.Lot, s.Gone)
+		}
+	}
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("gone slab was notified twice: %v", got)
+	}
+
+	// It is back in stock.
+	f.slabs = []slabfinder.Slab{long, short, other}
+	cycle(ctx, w)
+	if diff := cmp.Diff(map[string][]string{"kitchen": {"Returned long"}}, sentLots(rec)); diff != "" {
+		t.Errorf("returned slab:\n%s", diff)
+	}
+	for _, s := range w.slabs {
+		if !s.Gone.IsZero() {
+			t.Errorf("%s is still marked gone", s.Lot)
+		}
+	}
+}
+
+func TestGonePages(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)})
+	f := &staticFetcher{}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+	a := slabfinder.Slab{Lot: "a", Length: 132, Page: "a"}
+	b := slabfinder.Slab{Lot: "b", Length: 132, Page: "b"}
+	c := slabfinder.Slab{Lot: "c", Length: 132, Page: "a"}
+	legacy := slabfinder.Slab{Lot: "legacy", Length: 132}
+	f.slabs = []slabfinder.Slab{a, b, c, legacy}
+	cycle(ctx, w)
+
+	// Page b failed, so only the slab missing from page a is gone.
+	errs := &slabfinder.FetchError{Attempted: 2}
+	errs.Add("https://example.com/b", 0, slabfinder.PhaseFetch, errors.New("connection refused")).Page = "b"
+	f.slabs, f.err = []slabfinder.Slab{c}, errs
+	cycle(ctx, w)
+	gone := make(map[string]bool)
+	for _, s := range w.slabs {
+		gone[s.Lot] = !s.Gone.IsZero()
+	}
+	want := map[string]bool{"a": true, "b": false, "c": false, "legacy": false}
+	if diff := cmp.Diff(want, gone); diff != "" {
+		t.Errorf("gone slabs:\n%s", diff)
+	}
+}
+
+func TestStaleGone(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)})
+	f := &staticFetcher{}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+	sold := slabfinder.Slab{Lot: "sold", Length: 132, Vendor: slabfinder.Cosmos}
+	kept := slabfinder.Slab{Lot: "kept", Length: 132, Vendor: slabfinder.Cosmos, Page: "a"}
+	f.slabs = []slabfinder.Slab{sold, kept}
+	cycle(ctx, w)
+	sentLots(rec)
+
+	// Older versions didn't record when slabs were gone, so a slab sold
+	// long ago is only noticed after an upgrade.  It went when it was last
+	// seen, which is too long ago to notify about.
+	lastSeen := time.Now().Add(-30 * 24 * time.Hour)
+	id := sold.ID()
+	s := w.slabs[id]
+	s.LastSeen, s.Page = lastSeen, ""
+	w.slabs[id] = s
+	f.slabs = []slabfinder.Slab{kept}
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("stale slab notified: %v", got)
+	}
+	w.close()
+	w = testWatcher(t, cfg, f, rec)
+	if got := w.slabs[id].Gone; !got.Equal(lastSeen) {
+		t.Errorf("stale slab is gone at %v, want %v", got, lastSeen)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	cfg := testConfig(t, Profile{
+		Name:     "kitchen",
+		Criteria: lengthRule("island", 130, 200),
+		Changes:  []string{slabfinder.CountDecreased},
+	})
+	f := &staticFetcher{}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+	cycle(ctx, w)
+	f.slabs = []slabfinder.Slab{{Lot: "long", Length: 132, Count: 4}, {Lot: "short", Length: 60, Count: 4}}
+	cycle(ctx, w)
+	rec.Events()
+
+	// Two of the watched slabs sold, and so did some of the unwatched ones.
+	f.slabs[0].Count = 2
+	f.slabs[1].Count = 1
+	cycle(ctx, w)
+	events := rec.Events()
+	if len(events) != 1 || events[0].Type != notify.Changed || events[0].Slab.Lot != "long" {
+		t.Fatalf("got events %v, want long Changed", events)
+	}
+	want := []slabfinder.Change{{Kind: slabfinder.CountDecreased, Field: "Count", Old: "4", New: "2"}}
+	if diff := cmp.Diff(want, events[0].Changes, cmpopts.IgnoreFields(slabfinder.Change{}, "Time")); diff != "" {
+		t.Errorf("changes:\n%s", diff)
+	}
+
+	// Other kinds of change are recorded, but not notified.
+	f.slabs[0].Count = 3
+	f.slabs[0].Length = 133
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("unwanted changes notified: %v", got)
+	}
+	var kinds []string
+	for _, s := range w.slabs {
+		if s.Lot == "long" {
+			for _, c := range s.History {
+				kinds = append(kinds, c.Kind)
+			}
+		}
+	}
+	wantKinds := []string{slabfinder.CountDecreased, slabfinder.CountIncreased, slabfinder.DimensionsChanged}
+	if diff := cmp.Diff(wantKinds, kinds); diff != "" {
+		t.Errorf("history:\n%s", diff)
+	}
+}
+
+func TestDuplicateRows(t *testing.T) {
+	cfg := testConfig(t, Profile{
+		Name:     "kitchen",
+		Criteria: lengthRule("island", 130, 200),
+		Changes:  []string{slabfinder.CountDecreased, slabfinder.CountIncreased},
+	})
+	// The vendor lists the same slab twice, with different counts.
+	f := &staticFetcher{slabs: []slabfinder.Slab{{Key: "a", Lot: "long", Length: 132, Count: 2}, {Key: "a", Lot: "long", Length: 132, Count: 1}}}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+	cycle(ctx, w)
+	cycle(ctx, w)
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("notified: %v", got)
+	}
+	if len(w.slabs) != 1 {
+		t.Fatalf("%d known slabs, want 1", len(w.slabs))
+	}
+	for _, s := range w.slabs {
+		if s.Count != 3 || len(s.History) != 0 {
+			t.Errorf("slab has count %d and history %v, want 3 and none", s.Count, s.History)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)})
+	f := &staticFetcher{}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+	cycle(ctx, w)
+	f.slabs = []slabfinder.Slab{{Lot: "long", Length: 132, Photo: "long.jpg", Vendor: slabfinder.Cosmos}}
+	cycle(ctx, w)
+	if diff := cmp.Diff(map[string][]string{"kitchen": {"New long"}}, sentLots(rec)); diff != "" {
+		t.Fatalf("new slab:\n%s", diff)
+	}
+	firstSeen := w.slabs[slabIDs(w.slabs)[0]].FirstSeen
+
+	// After an upgrade, the vendor supplies a key, and the warehouse the
+	// older version didn't record, and the state is moved to the new ID
+	// without notifying the slab again.
+	w.close()
+	w = testWatcher(t, cfg, f, rec)
+	f.slabs[0].Key = "long/Atlanta"
+	f.slabs[0].Location = "Atlanta"
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("rekeyed slab notified: %v", got)
+	}
+	id := f.slabs[0].ID()
+	if diff := cmp.Diff([]uint64{id}, slabIDs(w.slabs)); diff != "" {
+		t.Errorf("slab IDs:\n%s", diff)
+	}
+	if got := w.slabs[id].FirstSeen; !got.Equal(firstSeen) {
+		t.Errorf("FirstSeen is %s, want %s", got, firstSeen)
+	}
+	if _, ok := w.notified["kitchen"][id]; !ok {
+		t.Errorf("notified is not rekeyed: %v", w.notified)
+	}
+
+	// The key is stable, so a new photo is a change to the same slab.
+	f.slabs[0].Photo = "long2.jpg"
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("new photo notified: %v", got)
+	}
+	if n := len(w.slabs[id].History); n != 1 {
+		t.Errorf("got %d changes in history, want 1", n)
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)})
+	cfg.Store = "json"
+	f := &staticFetcher{}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+	cycle(ctx, w)
+	f.slabs = []slabfinder.Slab{{Lot: "long", Length: 132}}
+	cycle(ctx, w)
+	if diff := cmp.Diff(map[string][]string{"kitchen": {"New long"}}, sentLots(rec)); diff != "" {
+		t.Fatalf("new slab:\n%s", diff)
+	}
+	want := w.slabs
+
+	// Switching to a new database keeps the slabs, and who was notified.
+	cfg.Store = "sqlite"
+	w.close()
+	w = testWatcher(t, cfg, f, rec)
+	if diff := cmp.Diff(want, w.slabs); diff != "" {
+		t.Errorf("imported slabs:\n%s", diff)
+	}
+	f.slabs = append(f.slabs, slabfinder.Slab{Lot: "long2", Length: 131})
+	cycle(ctx, w)
+	if diff := cmp.Diff(map[string][]string{"kitchen": {"New long2"}}, sentLots(rec)); diff != "" {
+		t.Errorf("cycle after import:\n%s", diff)
+	}
+}
+
+func TestUndeliveredSurviveRestart(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)})
+	f := &staticFetcher{slabs: []slabfinder.Slab{{Lot: "long", Length: 132}}}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, &failingNotifier{})
+	cycle(ctx, w)
+
+	// The notification can't be delivered, so it stays in the outbox.
+	f.slabs = append(f.slabs, slabfinder.Slab{Lot: "long2", Length: 131})
+	if err := cycle(ctx, w); err == nil {
+		t.Errorf("failed delivery was not reported")
+	}
+	if n := w.outbox.Len(); n != 1 {
+		t.Fatalf("outbox has %d entries, want 1", n)
+	}
+	key := w.outbox.Entries()[0].Events[0].Key
+
+	// After a restart, it is delivered, with the same key.
+	rec := &notify.Recorder{}
+	w.close()
+	w = testWatcher(t, cfg, f, rec)
+	if err := w.outbox.Deliver(ctx, w.deliver); err != nil {
+		t.Fatal(err)
+	}
+	events := rec.Events()
+	if len(events) != 1 || events[0].Slab.Lot != "long2" || events[0].Key != key {
+		t.Errorf("delivered %v after restart, want long2 with key %s", events, key)
+	}
+	if n := w.outbox.Len(); n != 0 {
+		t.Errorf("outbox has %d entries after delivery, want 0", n)
+	}
+
+	// It is not queued again.
+	cycle(ctx, w)
+	if got := sentLots(rec); len(got) != 0 {
+		t.Errorf("cycle after restart notified: %v", got)
+	}
+}
+
+func TestKeysSurviveCrash(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200), Changes: []string{slabfinder.CountDecreased}})
+	f := &staticFetcher{slabs: []slabfinder.Slab{{Key: "a", Lot: "a", Length: 132, Count: 2}, {Key: "b", Lot: "b", Length: 140}}}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, &notify.Recorder{})
+	cycle(ctx, w)
+
+	// crash runs a cycle which stops after queueing its notifications,
+	// before the state is saved, then restarts the watcher.  It returns
+	// the events delivered by the next cycle, which queues them again.
+	crash := func() []notify.Event {
+		t.Helper()
+		// The crashed cycle's time must not matter, so make it differ
+		// from the next cycle's, even within a second.
+		now := time.Now().Add(-time.Minute)
+		u := w.merge(slabfinder.FetchAll(ctx, w.fetchers, w.cfg.Workers), now)
+		if err := w.outbox.Add(w.queue(u, now)...); err != nil {
+			t.Fatal(err)
+		}
+		w.close()
+		rec := &notify.Recorder{}
+		w = testWatcher(t, cfg, f, rec)
+		if err := cycle(ctx, w); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Events()
+	}
+	// Each event is delivered twice, with the same key.
+	check := func(events []notify.Event, want []string) {
+		t.Helper()
+		keys := make(map[string][]string)
+		for _, e := range events {
+			keys[e.Type.String()+" "+e.Slab.Lot] = append(keys[e.Type.String()+" "+e.Slab.Lot], e.Key)
+		}
+		var got []string
+		for event, k := range keys {
+			got = append(got, event)
+			if len(k) != 2 || k[0] != k[1] {
+				t.Errorf("%s: delivered with keys %q, want the same key twice", event, k)
+			}
+		}
+		sort.Strings(got)
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("events:\n%s", diff)
+		}
+	}
+
+	f.slabs = []slabfinder.Slab{{Key: "a", Lot: "a", Length: 132, Count: 1}, {Key: "c", Lot: "c", Length: 135}}
+	check(crash(), []string{"Changed a", "Gone b", "New c"})
+	f.slabs = append(f.slabs, slabfinder.Slab{Key: "b", Lot: "b", Length: 140})
+	check(crash(), []string{"Returned b"})
+}
+
+func TestUnreachableAlert(t *testing.T) {
+	cfg := testConfig(t, Profile{Name: "kitchen", Criteria: lengthRule("island", 130, 200)})
+	cfg.AlertAfter = 2
+	f := &staticFetcher{err: errors.New("connection refused")}
+	rec := &notify.Recorder{}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, rec)
+
+	w.cycle(ctx)
+	if got := rec.Alerts(); len(got) != 0 {
+		t.Errorf("alerted after one failed cycle: %v", got)
+	}
+	w.cycle(ctx)
+	if got := rec.Alerts(); len(got) != 1 {
+		t.Errorf("got alerts %v after two failed cycles, want one", got)
+	}
+	w.cycle(ctx)
+	if got := rec.Alerts(); len(got) != 0 {
+		t.Errorf("alerted again after three failed cycles: %v", got)
+	}
+}
+
+func TestDashboardReadsLiveState(t *testing.T) {
+	cfg := testConfig(t)
+	f := &staticFetcher{slabs: []slabfinder.Slab{{Key: "a", Lot: "a", Color: "Titanium", Length: 132}}}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, &notify.Recorder{})
+	d := dashboard.New(w.snapshot)
+
+	// The dashboard is read while cycles run.
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+	}()
+	cycle(ctx, w)
+	f.slabs = append(f.slabs, slabfinder.Slab{Key: "b", Lot: "b", Color: "Titanium", Length: 140})
+	cycle(ctx, w)
+	<-done
+
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest("GET", "/?min_length=135", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "1 of 2 slabs") {
+		t.Errorf("dashboard doesn't show the latest cycle:\n%s", body)
+	}
+}
+
+func TestAPIState(t *testing.T) {
+	cfg := testConfig(t)
+	f := &staticFetcher{slabs: []slabfinder.Slab{{Key: "a", Lot: "a", Count: 2}, {Key: "b", Lot: "b"}}}
+	ctx := context.Background()
+	w := testWatcher(t, cfg, f, &notify.Recorder{})
+	cycle(ctx, w)
+	f.err = errors.New("connection refused")
+	cycle(ctx, w)
+	f.slabs, f.err = []slabfinder.Slab{{Key: "a", Lot: "a", Count: 1}}, nil
+	cycle(ctx, w)
+
+	src := w.apiSource()
+	vendors := src.Vendors()
+	if len(vendors) != 1 || vendors[0].Fetcher != "static" || vendors[0].Error != "" || vendors[0].LastSuccess == nil {
+		t.Errorf("vendors = %+v", vendors)
+	}
+	type event struct{ Type, Lot string }
+	var got []event
+	for _, e := range src.Events(time.Time{}) {
+		got = append(got, event{e.Type, e.Slab.Lot})
+	}
+	want := []event{{"new", "a"}, {"new", "b"}, {"changed", "a"}, {"gone", "b"}}
+	sortEvents := cmpopts.SortSlices(func(a, b event) bool { return a.Type+a.Lot < b.Type+b.Lot })
+	if diff := cmp.Diff(want, got, sortEvents); diff != "" {
+		t.Errorf("events:\n%s", diff)
+	}
+
+	// The events survive a restart, as far as the state records them.
+	w.close()
+	w = testWatcher(t, cfg, f, &notify.Recorder{})
+	got = nil
+	for _, e := range w.apiSource().Events(time.Time{}) {
+		got = append(got, event{e.Type, e.Slab.Lot})
+	}
+	if diff := cmp.Diff(want, got, sortEvents); diff != "" {
+		t.Errorf("events after restart:\n%s", diff)
+	}
+}
@@ -0,0 +1,247 @@
+// Package criteria decides which slabs are interesting.
+//
+// Criteria are a list of named Rules, and a slab is interesting if any Rule
+// matches it.  Each Rule is a Condition: a set of tests on the fields of a
+// Slab which must all pass, which may be combined with "all" (AND), "any" (OR)
+// and "not".  They are usually loaded from the slabwatcher config file:
+//
+//	criteria:
+//	  - name: island
+//	    length: {min: 130}
+//	    width: {min: 76}
+//	    finish: [Leather, Honed]
+//	  - name: vanity
+//	    length: {max: 72}
+//	    color: "(?i)white|cream"
+//	    not:
+//	      vendor: [OHM]
+package criteria
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+// Criteria is a list of Rules, a slab is interesting if any of them match.
+type Criteria []Rule
+
+// Rule is a named Condition.
+type Rule struct {
+	Name      string `yaml:"name"`
+	Condition `yaml:",inline"`
+}
+
+// Condition is a set of tests on the fields of a Slab.  Every test which is
+// set must pass for the Condition to match, so an empty Condition matches
+// every slab.
+type Condition struct {
+	All []Condition `yaml:"all"` // every one of these must match
+	Any []Condition `yaml:"any"` // at least one of these must match
+	Not *Condition  `yaml:"not"` // this must not match
+
+	Length    *Range `yaml:"length"`    // inches
+	Width     *Range `yaml:"width"`     // inches
+	Thickness *Range `yaml:"thickness"` // CM
+	Count     *Range `yaml:"count"`     // slabs in the lot
+	Price     *Range `yaml:"price"`     // dollars, 0 if the vendor doesn't say
+
+	Finish []string `yaml:"finish"` // any of these finishes, eg. "Leather"
+	Vendor []string `yaml:"vendor"` // any of these vendors, eg. "Cosmos"
+
+	Color    *Regexp `yaml:"color"`
+	Location *Regexp `yaml:"location"`
+	Lot      *Regexp `yaml:"lot"`
+	Bundle   *Regexp `yaml:"bundle"`
+}
+
+// Range matches values between Min and Max, inclusive.  Either may be unset.
+type Range struct {
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+}
+
+// Regexp is a regular expression, which unmarshals from a string.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// NewRegexp compiles expr, which uses the syntax of the regexp package.
+func NewRegexp(expr string) (*Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Regexp{re}, nil
+}
+
+// UnmarshalText compiles the regular expression.
+func (r *Regexp) UnmarshalText(text []byte) error {
+	re, err := regexp.Compile(string(text))
+	if err != nil {
+		return err
+	}
+	r.Regexp = re
+	return nil
+}
+
+// MarshalText returns the source of the regular expression.
+func (r Regexp) MarshalText() ([]byte, error) {
+	if r.Regexp == nil {
+		return nil, nil
+	}
+	return []byte(r.String()), nil
+}
+
+// Validate reports mistakes in the Criteria, like unknown finishes or empty
+// ranges, so they can be caught when the config is loaded.
+func (c Criteria) Validate() error {
+	names := make(map[string]bool)
+	for i, r := range c {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("rule %q is defined twice", r.Name)
+		}
+		names[r.Name] = true
+		if err := r.Condition.validate(); err != nil {
+			return fmt.Errorf("rule %q: %s", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Match returns the name of the first Rule which matches the slab.
+func (c Criteria) Match(s slabfinder.Slab) (string, bool) {
+	for _, r := range c {
+		if r.Matches(s) {
+			return r.Name, true
+		}
+	}
+	return "", false
+}
+
+// MatchAll returns the names of every Rule which matches the slab.
+func (c Criteria) MatchAll(s slabfinder.Slab) []string {
+	var names []string
+	for _, r := range c {
+		if r.Matches(s) {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+func (c *Condition) validate() error {
+	for _, sub := range c.All {
+		if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	for _, sub := range c.Any {
+		if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		if err := c.Not.validate(); err != nil {
+			return err
+		}
+	}
+	for name, r := range map[string]*Range{"length": c.Length, "width": c.Width, "thickness": c.Thickness, "count": c.Count, "price": c.Price} {
+		if r != nil && r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("%s: min %v is greater than max %v", name, *r.Min, *r.Max)
+		}
+	}
+	for _, f := range c.Finish {
+		if _, err := slabfinder.ParseFinish(f); err != nil {
+			return err
+		}
+	}
+	for _, v := range c.Vendor {
+		if _, err := slabfinder.ParseVendor(v); err != nil {
+			return err
+		}
+	}
+	for name, re := range map[string]*Regexp{"color": c.Color, "location": c.Location, "lot": c.Lot, "bundle": c.Bundle} {
+		if re != nil && re.Regexp == nil {
+			return fmt.Errorf("%s: empty regular expression", name)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether every test in the Condition passes for the slab.
+func (c *Condition) Matches(s slabfinder.Slab) bool {
+	for _, sub := range c.All {
+		if !sub.Matches(s) {
+			return false
+		}
+	}
+	if len(c.Any) > 0 {
+		matched := false
+		for _, sub := range c.Any {
+			if sub.Matches(s) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if c.Not != nil && c.Not.Matches(s) {
+		return false
+	}
+	if !c.Length.contains(s.Length) ||
+		!c.Width.contains(s.Width) ||
+		!c.Thickness.contains(s.Thickness) ||
+		!c.Count.contains(float64(s.Count)) ||
+		!c.Price.contains(float64(s.Price)/100) {
+		return false
+	}
+	if len(c.Finish) > 0 && !containsFold(c.Finish, s.Finish.String()) {
+		return false
+	}
+	if len(c.Vendor) > 0 && !containsFold(c.Vendor, s.Vendor.String()) {
+		return false
+	}
+	return c.Color.matches(s.Color) &&
+		c.Location.matches(s.Location) &&
+		c.Lot.matches(s.Lot) &&
+		c.Bundle.matches(s.Bundle)
+}
+
+// contains reports whether v is in the Range, a nil Range contains everything.
+func (r *Range) contains(v float64) bool {
+	if r == nil {
+		return true
+	}
+	if r.Min != nil && v < *r.Min {
+		return false
+	}
+	if r.Max != nil && v > *r.Max {
+		return false
+	}
+	return true
+}
+
+// matches reports whether v matches, a nil Regexp matches everything.
+func (r *Regexp) matches(v string) bool {
+	if r == nil || r.Regexp == nil {
+		return true
+	}
+	return r.MatchString(v)
+}
+
+func containsFold(list []string, v string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package criteria
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+const testRules = `
+- name: island
+  length: {min: 130}
+  width: {min: 76}
+  any:
+    - finish: [leather, honed]
+    - color: "(?i)black"
+- name: vanity
+  length: {max: 72}
+  color: "(?i)white|cream"
+  not:
+    vendor: [OHM]
+- name: cheap
+  price: {max: 500}
+  count: {min: 2}
+  thickness: {min: 3, max: 3}
+`
+
+func loadRules(t *testing.T, input string) Criteria {
+	t.Helper()
+	var c Criteria
+	if err := yaml.Unmarshal([]byte(input), &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMatch(t *testing.T) {
+	c := loadRules(t, testRules)
+	tests := []struct {
+		name string
+		slab slabfinder.Slab
+		want []string
+	}{
+		{
+			name: "long leathered slab",
+			slab: slabfinder.Slab{Length: 132, Width: 78, Finish: slabfinder.Leather, Color: "Grey"},
+			want: []string{"island"},
+		},
+		{
+			name: "long polished black slab",
+			slab: slabfinder.Slab{Length: 132, Width: 78, Finish: slabfinder.Polished, Color: "Black, White"},
+			want: []string{"island"},
+		},
+		{
+			name: "long polished grey slab",
+			slab: slabfinder.Slab{Length: 132, Width: 78, Finish: slabfinder.Polished, Color: "Grey"},
+		},
+		{
+			name: "narrow leathered slab",
+			slab: slabfinder.Slab{Length: 132, Width: 70, Finish: slabfinder.Leather},
+		},
+		{
+			name: "white remnant",
+			slab: slabfinder.Slab{Length: 60, Width: 30, Color: "White", Vendor: slabfinder.Cosmos},
+			want: []string{"vanity"},
+		},
+		{
+			name: "white remnant at excluded vendor",
+			slab: slabfinder.Slab{Length: 60, Width: 30, Color: "White", Vendor: slabfinder.OHM},
+		},
+		{
+			name: "cheap pair matches two rules",
+			slab: slabfinder.Slab{Length: 70, Color: "cream", Vendor: slabfinder.StoneBasyx, Price: 45000, Count: 2, Thickness: 3},
+			want: []string{"vanity", "cheap"},
+		},
+		{
+			name: "expensive pair",
+			slab: slabfinder.Slab{Price: 65000, Count: 2, Thickness: 3},
+		},
+	}
+	for _, tc := range tests {
+		got := c.MatchAll(tc.slab)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s:\n%s", tc.name, diff)
+		}
+		rule, ok := c.Match(tc.slab)
+		if ok != (len(tc.want) > 0) || (ok && rule != tc.want[0]) {
+			t.Errorf("%s: Match() = %q, %t, want the first of %v", tc.name, rule, ok, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"- length: {min: 1}\n", "rule 0 has no name"},
+		{"- name: a\n- name: a\n", `rule "a" is defined twice`},
+		{"- name: a\n  length: {min: 10, max: 5}\n", "length: min 10 is greater than max 5"},
+		{"- name: a\n  finish: [shiny]\n", `unknown finish: "shiny"`},
+		{"- name: a\n  any:\n    - vendor: [Granite City]\n", `unknown vendor: "Granite City"`},
+	}
+	for _, tc := range tests {
+		var c Criteria
+		if err := yaml.Unmarshal([]byte(tc.input), &c); err != nil {
+			t.Errorf("%q: %s", tc.input, err)
+			continue
+		}
+		err := c.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got error %v, want %q", tc.input, err, tc.want)
+		}
+	}
+}
+
+func TestBadRegexp(t *testing.T) {
+	var c Criteria
+	err := yaml.Unmarshal([]byte("- name: a\n  color: \"(unclosed\"\n"), &c)
+	if err == nil {
+		t.Errorf("an invalid regular expression was accepted")
+	}
+}
@@ -0,0 +1,75 @@
+package criteria
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// FromQuery returns the Condition described by URL query parameters, as used
+// by the dashboard: "vendor" and "finish" may be repeated or comma separated;
+// "color", "location", "lot" and "bundle" are case insensitive regular
+// expressions; and "min_length", "max_width", etc. bound the Ranges, with
+// "thickness" matching one thickness exactly.  Empty parameters are ignored,
+// and so are any others, so they can be used for other things.
+func FromQuery(q url.Values) (Condition, error) {
+	var c Condition
+	for _, name := range []string{"vendor", "finish"} {
+		var list []string
+		for _, v := range q[name] {
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+		}
+		if name == "vendor" {
+			c.Vendor = list
+		} else {
+			c.Finish = list
+		}
+	}
+	for name, re := range map[string]**Regexp{"color": &c.Color, "location": &c.Location, "lot": &c.Lot, "bundle": &c.Bundle} {
+		if v := q.Get(name); v != "" {
+			var err error
+			if *re, err = NewRegexp("(?i)" + v); err != nil {
+				return c, fmt.Errorf("%s: %s", name, err)
+			}
+		}
+	}
+	for name, r := range map[string]**Range{"length": &c.Length, "width": &c.Width, "thickness": &c.Thickness, "count": &c.Count, "price": &c.Price} {
+		min, err := queryFloat(q, "min_"+name)
+		if err != nil {
+			return c, err
+		}
+		max, err := queryFloat(q, "max_"+name)
+		if err != nil {
+			return c, err
+		}
+		if min != nil || max != nil {
+			*r = &Range{Min: min, Max: max}
+		}
+	}
+	exact, err := queryFloat(q, "thickness")
+	if err != nil {
+		return c, err
+	}
+	if exact != nil {
+		c.Thickness = &Range{Min: exact, Max: exact}
+	}
+	return c, c.validate()
+}
+
+// queryFloat returns the named parameter, or nil if it is empty.
+func queryFloat(q url.Values, name string) (*float64, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %q is not a number", name, v)
+	}
+	return &f, nil
+}
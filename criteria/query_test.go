@@ -0,0 +1,60 @@
+package criteria
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+func TestFromQuery(t *testing.T) {
+	slab := slabfinder.Slab{Vendor: slabfinder.Cosmos, Finish: slabfinder.Leather, Color: "Titanium", Length: 132, Width: 78, Thickness: 3}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"vendor=cosmos", true},
+		{"vendor=OHM,Cosmos", true},
+		{"vendor=OHM&vendor=StoneBasyx", false},
+		{"finish=leather&color=titan", true},
+		{"color=^white", false},
+		{"min_length=130&max_length=&min_width=76", true},
+		{"min_length=133", false},
+		{"thickness=3", true},
+		{"thickness=2", false},
+		{"max_thickness=2", false},
+		{"sort=length&page=2", true},
+	}
+	for _, tc := range tests {
+		q, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := FromQuery(q)
+		if err != nil {
+			t.Errorf("%q: %s", tc.query, err)
+			continue
+		}
+		if got := c.Matches(slab); got != tc.want {
+			t.Errorf("%q matches %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	for query, want := range map[string]string{
+		"vendor=Granite+City":        `unknown vendor: "Granite City"`,
+		"min_length=long":            `min_length: "long" is not a number`,
+		"min_length=10&max_length=5": "length: min 10 is greater than max 5",
+		"color=%28unclosed":          "color: ",
+		"thickness=3cm":              `thickness: "3cm" is not a number`,
+	} {
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := FromQuery(q); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want %q", query, err, want)
+		}
+	}
+}
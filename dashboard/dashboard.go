@@ -0,0 +1,229 @@
+// Package dashboard serves a web page of the known slabs: a grid of their
+// photos, which can be filtered and sorted, and a page for each slab with its
+// history.  The templates are embedded, so there is nothing else to install.
+//
+// The slabs are read from a Source on every request, so the pages are as
+// current as the watcher's state.
+package dashboard
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/criteria"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+// Source returns the known slabs, by Slab.ID().  The map must not be modified
+// afterwards, the dashboard reads it while serving the request.
+type Source func() map[uint64]slabfinder.Slab
+
+// Sorts are the orders of the grid, by the value of the "sort" parameter.
+var Sorts = []Sort{
+	{"length", "Longest", func(a, b slabfinder.Slab) bool { return a.Length > b.Length }},
+	{"area", "Largest", func(a, b slabfinder.Slab) bool { return a.Length*a.Width > b.Length*b.Width }},
+	{"newest", "Newest", func(a, b slabfinder.Slab) bool { return a.FirstSeen.After(b.FirstSeen) }},
+	{"oldest", "Oldest", func(a, b slabfinder.Slab) bool { return a.FirstSeen.Before(b.FirstSeen) }},
+}
+
+// Sort is one order of the grid.
+type Sort struct {
+	Name  string
+	Title string
+	less  func(a, b slabfinder.Slab) bool
+}
+
+// LookupSort returns the Sort with the given name.
+func LookupSort(name string) (Sort, bool) {
+	for _, s := range Sorts {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Sort{}, false
+}
+
+// Less reports whether a comes before b in the order.
+func (s Sort) Less(a, b slabfinder.Slab) bool {
+	return s.less(a, b)
+}
+
+// Windows are the choices of how recently a slab was first seen, in days.
+var Windows = []int{1, 7, 30, 90, 365}
+
+// Dashboard is an http.Handler serving the pages.
+type Dashboard struct {
+	src   Source
+	pages map[string]*template.Template
+	mux   *http.ServeMux
+
+	now func() time.Time // replaced by tests
+}
+
+// New returns a Dashboard of the slabs from src.
+func New(src Source) *Dashboard {
+	d := &Dashboard{src: src, pages: make(map[string]*template.Template), mux: http.NewServeMux(), now: time.Now}
+	funcs := template.FuncMap{
+		"id":   func(s slabfinder.Slab) string { return slabfinder.FormatID(s.ID()) },
+		"date": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+		"age":  d.age,
+		"dollars": func(pennies int) float64 {
+			return float64(pennies) / 100
+		},
+	}
+	for _, page := range []string{"grid", "slab"} {
+		d.pages[page] = template.Must(template.New(page).Funcs(funcs).ParseFS(templates, "templates/layout.html", "templates/"+page+".html"))
+	}
+	d.mux.HandleFunc("/", d.grid)
+	d.mux.HandleFunc("/slab/", d.slab)
+	return d
+}
+
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
+
+// gridPage is the data for the grid template.
+type gridPage struct {
+	Slabs      []slabfinder.Slab
+	Total      int // the number of known slabs, before filtering
+	Error      string
+	Query      map[string]string // the filter parameters, to fill in the form
+	Vendors    []string
+	Finishes   []string
+	Thickness  []float64
+	Sorts      []Sort
+	Windows    []int
+	ShowGone   bool
+	SortedBy   string
+	SeenWithin int
+}
+
+// grid serves the photo grid, filtered by the criteria.FromQuery parameters,
+// "seen" (first seen within that many days), "gone" (include slabs which are
+// gone) and "sort".
+func (d *Dashboard) grid(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	p := gridPage{
+		Query:    make(map[string]string),
+		Sorts:    Sorts,
+		Windows:  Windows,
+		ShowGone: q.Get("gone") != "",
+		SortedBy: q.Get("sort"),
+	}
+	for name := range q {
+		p.Query[name] = q.Get(name)
+	}
+	sortBy, ok := LookupSort(p.SortedBy)
+	if !ok {
+		sortBy = Sorts[0]
+	}
+	p.SortedBy = sortBy.Name
+	cond, err := criteria.FromQuery(q)
+	if err != nil {
+		p.Error = err.Error()
+	}
+	if s := q.Get("seen"); s != "" {
+		if p.SeenWithin, err = strconv.Atoi(s); err != nil {
+			p.Error = fmt.Sprintf("seen: %q is not a number of days", s)
+		}
+	}
+	var since time.Time
+	if p.SeenWithin > 0 {
+		since = d.now().AddDate(0, 0, -p.SeenWithin)
+	}
+
+	vendors, finishes, thickness := make(map[string]bool), make(map[string]bool), make(map[float64]bool)
+	for _, s := range d.src() {
+		p.Total++
+		vendors[s.Vendor.String()] = true
+		finishes[s.Finish.String()] = true
+		thickness[s.Thickness] = true
+		if p.Error != "" || (!s.Gone.IsZero() && !p.ShowGone) || s.FirstSeen.Before(since) || !cond.Matches(s) {
+			continue
+		}
+		p.Slabs = append(p.Slabs, s)
+	}
+	sort.SliceStable(p.Slabs, func(i, j int) bool {
+		a, b := p.Slabs[i], p.Slabs[j]
+		if sortBy.less(a, b) || sortBy.less(b, a) {
+			return sortBy.less(a, b)
+		}
+		return a.ID() < b.ID() // keep the order stable between requests
+	})
+	p.Vendors, p.Finishes = sortedKeys(vendors), sortedKeys(finishes)
+	for t := range thickness {
+		p.Thickness = append(p.Thickness, t)
+	}
+	sort.Float64s(p.Thickness)
+	if p.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	d.render(w, "grid", p)
+}
+
+// slabPage is the data for the slab template.
+type slabPage struct {
+	slabfinder.Slab
+	ID string
+}
+
+// slab serves the page of the slab with the ID in the path.
+func (d *Dashboard) slab(w http.ResponseWriter, r *http.Request) {
+	id, err := slabfinder.ParseID(strings.TrimPrefix(r.URL.Path, "/slab/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s, ok := d.src()[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	d.render(w, "slab", slabPage{s, slabfinder.FormatID(id)})
+}
+
+func (d *Dashboard) render(w http.ResponseWriter, page string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := d.pages[page].ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("dashboard: rendering %s: %s", page, err)
+	}
+}
+
+// age describes how long ago t was, in the largest whole unit.
+func (d *Dashboard) age(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	switch age := d.now().Sub(t); {
+	case age < time.Hour:
+		return fmt.Sprintf("%d minutes ago", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%d hours ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%d days ago", int(age.Hours()/24))
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+var now = time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+
+func testDashboard() *Dashboard {
+	slabs := []slabfinder.Slab{
+		{Vendor: slabfinder.Cosmos, Key: "1", Color: "Titanium", Lot: "long", Finish: slabfinder.Leather, Thickness: 3, Length: 132, Width: 70, FirstSeen: now.AddDate(0, 0, -40)},
+		{Vendor: slabfinder.Cosmos, Key: "2", Color: "Titanium", Lot: "wide", Finish: slabfinder.Polished, Thickness: 3, Length: 126, Width: 79, FirstSeen: now.AddDate(0, 0, -2),
+			History: []slabfinder.Change{{Time: now.AddDate(0, 0, -1), Kind: slabfinder.PriceChanged, Field: "Price", Old: "$1200.00", New: "$990.00"}}},
+		{Vendor: slabfinder.OHM, Key: "3", Color: "White Ice", Lot: "short", Finish: slabfinder.Leather, Thickness: 2, Length: 100, Width: 60, FirstSeen: now.AddDate(0, 0, -10)},
+		{Vendor: slabfinder.OHM, Key: "4", Color: "White Ice", Lot: "sold", Finish: slabfinder.Leather, Thickness: 2, Length: 140, Width: 60, FirstSeen: now.AddDate(0, 0, -10), Gone: now.AddDate(0, 0, -1)},
+	}
+	m := make(map[uint64]slabfinder.Slab)
+	for _, s := range slabs {
+		s.Photo = "https://example.com/" + s.Lot + ".jpg"
+		m[s.ID()] = s
+	}
+	d := New(func() map[uint64]slabfinder.Slab { return m })
+	d.now = func() time.Time { return now }
+	return d
+}
+
+// altRE matches the alt text of each photo, which names the lot.
+var altRE = regexp.MustCompile(`alt="[^"]* lot ([^"]*)"`)
+
+func TestGrid(t *testing.T) {
+	d := testDashboard()
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"long", "wide", "short"}},
+		{"?sort=area", []string{"wide", "long", "short"}},
+		{"?sort=newest", []string{"wide", "short", "long"}},
+		{"?sort=oldest", []string{"long", "short", "wide"}},
+		{"?gone=1", []string{"sold", "long", "wide", "short"}},
+		{"?vendor=cosmos&finish=leather", []string{"long"}},
+		{"?thickness=2", []string{"short"}},
+		{"?min_length=130&gone=1", []string{"sold", "long"}},
+		{"?seen=7", []string{"wide"}},
+		{"?seen=30&color=white", []string{"short"}},
+	}
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest("GET", "/"+tc.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%q: status %d", tc.query, rec.Code)
+		}
+		var got []string
+		for _, m := range altRE.FindAllStringSubmatch(rec.Body.String(), -1) {
+			got = append(got, m[1])
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%q:\n%s", tc.query, diff)
+		}
+	}
+
+	for _, query := range []string{"?min_length=long", "?seen=week"} {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest("GET", "/"+query, nil))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `class="error"`) {
+			t.Errorf("%q: status %d, want an error", query, rec.Code)
+		}
+	}
+}
+
+func TestSlab(t *testing.T) {
+	d := testDashboard()
+	wide := slabfinder.Slab{Vendor: slabfinder.Cosmos, Key: "2"}
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest("GET", "/slab/"+slabfinder.FormatID(wide.ID()), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	for _, want := range []string{"<title>Titanium lot wide - slabwatcher</title>", "2 days ago", "$1200.00", "$990.00"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("slab page doesn't contain %q:\n%s", want, rec.Body.String())
+		}
+	}
+
+	for _, path := range []string{"/slab/0000000000000001", "/slab/nonsense", "/favicon.ico"} {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
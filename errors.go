@@ -0,0 +1,111 @@
+package slabfinder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Phase describes how far a Fetcher got with a page before it failed.
+type Phase int
+
+const (
+	UnknownPhase Phase = 0
+	PhaseFetch   Phase = 1 // the request failed, or returned a bad status
+	PhaseRead    Phase = 2 // the response body could not be read
+	PhaseParse   Phase = 3 // the response body could not be understood
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseFetch:
+		return "fetch"
+	case PhaseRead:
+		return "read"
+	case PhaseParse:
+		return "parse"
+	}
+	return "UnknownPhase"
+}
+
+// PageError describes one vendor page which a Fetcher could not retrieve.
+type PageError struct {
+	URL        string
+	Page       string // identifies the page, if its URL doesn't
+	StatusCode int    // the HTTP status, or 0 if there was no response
+	Phase      Phase
+	Err        error
+}
+
+func (e *PageError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s %s (HTTP %d): %s", e.Phase, e.URL, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Phase, e.URL, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// FetchError is returned by a Fetcher when some or all of the pages it
+// consulted failed.  The slabs from the pages which succeeded are returned
+// alongside it.
+type FetchError struct {
+	Attempted int          // how many pages the Fetcher tried
+	Pages     []*PageError // the pages which failed
+}
+
+// Add records a page which failed, and returns its PageError.
+func (e *FetchError) Add(url string, statusCode int, phase Phase, err error) *PageError {
+	p := &PageError{URL: url, StatusCode: statusCode, Phase: phase, Err: err}
+	e.Pages = append(e.Pages, p)
+	return p
+}
+
+// Failed reports whether the page, identified as in Slab.Page, failed.
+func (e *FetchError) Failed(page string) bool {
+	for _, p := range e.Pages {
+		if p.Page == page || p.Page == "" && p.URL == page {
+			return true
+		}
+	}
+	return false
+}
+
+// Unreachable reports whether every page the Fetcher tried failed, so there is
+// no information at all about the vendor's inventory.
+func (e *FetchError) Unreachable() bool {
+	return len(e.Pages) > 0 && len(e.Pages) >= e.Attempted
+}
+
+// ErrOrNil returns e if any pages failed, and nil otherwise, so it can be
+// returned directly from Fetch.
+func (e *FetchError) ErrOrNil() error {
+	if e == nil || len(e.Pages) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *FetchError) Error() string {
+	var msgs []string
+	for _, p := range e.Pages {
+		msgs = append(msgs, p.Error())
+	}
+	return fmt.Sprintf("%d of %d pages failed: %s", len(e.Pages), e.Attempted, strings.Join(msgs, "; "))
+}
+
+// Unreachable reports whether err indicates that none of a vendor's pages
+// could be retrieved.  A nil error, or a FetchError where only some pages
+// failed, is not unreachable.  Any other error is assumed to be.
+func Unreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		return fe.Unreachable()
+	}
+	return true
+}
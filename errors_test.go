@@ -0,0 +1,48 @@
+package slabfinder
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFetchError(t *testing.T) {
+	fe := &FetchError{}
+	if err := fe.ErrOrNil(); err != nil {
+		t.Errorf("empty FetchError.ErrOrNil() = %v, want nil", err)
+	}
+	if Unreachable(fe.ErrOrNil()) {
+		t.Errorf("a successful fetch with zero slabs is unreachable")
+	}
+
+	fe.Attempted = 2
+	fe.Add("https://example.com/a", 503, PhaseFetch, errors.New("bad status"))
+	err := fe.ErrOrNil()
+	if err == nil {
+		t.Fatalf("FetchError.ErrOrNil() = nil after a page failed")
+	}
+	if Unreachable(err) {
+		t.Errorf("Unreachable(%q) = true with one of two pages fetched", err)
+	}
+
+	fe.Add("https://example.com/b", 0, PhaseParse, errors.New("bad JSON")).Page = "Titanium"
+	for page, want := range map[string]bool{
+		"https://example.com/a": true,
+		"https://example.com/b": false, // it is identified by its Page
+		"Titanium":              true,
+		"https://example.com/c": false,
+	} {
+		if got := fe.Failed(page); got != want {
+			t.Errorf("Failed(%q) = %t, want %t", page, got, want)
+		}
+	}
+	wrapped := fmt.Errorf("cosmos: %w", fe.ErrOrNil())
+	if !Unreachable(wrapped) {
+		t.Errorf("Unreachable(%q) = false with every page failed", wrapped)
+	}
+
+	want := "2 of 2 pages failed: fetch https://example.com/a (HTTP 503): bad status; parse https://example.com/b: bad JSON"
+	if got := fe.Error(); got != want {
+		t.Errorf("FetchError.Error() = %q, want %q", got, want)
+	}
+}
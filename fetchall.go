@@ -0,0 +1,66 @@
+package slabfinder
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FetchResult is the outcome of consulting one Fetcher.
+type FetchResult struct {
+	Fetcher  string // the Name of the Fetcher
+	Vendor   Vendor
+	Slabs    []Slab
+	Err      error
+	Start    time.Time
+	Duration time.Duration
+}
+
+// FetchResults are returned by FetchAll, in the order the Fetchers were given.
+type FetchResults []FetchResult
+
+// Slabs merges the slabs from all the results, in order.
+func (rs FetchResults) Slabs() []Slab {
+	var slabs []Slab
+	for _, r := range rs {
+		slabs = append(slabs, r.Slabs...)
+	}
+	return slabs
+}
+
+// FetchAll consults the fetchers concurrently, using at most workers
+// goroutines, and returns their results in the same order as fetchers.  If
+// workers is less than 1, every fetcher is run at once.
+func FetchAll(ctx context.Context, fetchers []Fetcher, workers int) FetchResults {
+	if workers < 1 || workers > len(fetchers) {
+		workers = len(fetchers)
+	}
+	results := make(FetchResults, len(fetchers))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				f := fetchers[i]
+				start := time.Now()
+				slabs, err := f.Fetch(ctx)
+				results[i] = FetchResult{
+					Fetcher:  f.Name(),
+					Vendor:   f.Vendor(),
+					Slabs:    slabs,
+					Err:      err,
+					Start:    start,
+					Duration: time.Since(start),
+				}
+			}
+		}()
+	}
+	for i := range fetchers {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
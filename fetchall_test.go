@@ -0,0 +1,73 @@
+package slabfinder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// slowFetcher returns one slab after a delay, and tracks how many
+// slowFetchers are running at once.
+type slowFetcher struct {
+	name  string
+	delay time.Duration
+	err   error
+	gauge *gauge
+}
+
+type gauge struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (f slowFetcher) Name() string   { return f.name }
+func (f slowFetcher) Vendor() Vendor { return Cosmos }
+func (f slowFetcher) Fetch(ctx context.Context) ([]Slab, error) {
+	f.gauge.mu.Lock()
+	f.gauge.running++
+	if f.gauge.running > f.gauge.max {
+		f.gauge.max = f.gauge.running
+	}
+	f.gauge.mu.Unlock()
+	time.Sleep(f.delay)
+	f.gauge.mu.Lock()
+	f.gauge.running--
+	f.gauge.mu.Unlock()
+	return []Slab{{Lot: f.name}}, f.err
+}
+
+func TestFetchAll(t *testing.T) {
+	g := &gauge{}
+	failure := errors.New("unreachable")
+	fetchers := []Fetcher{
+		slowFetcher{name: "a", delay: 30 * time.Millisecond, gauge: g},
+		slowFetcher{name: "b", delay: 10 * time.Millisecond, gauge: g, err: failure},
+		slowFetcher{name: "c", delay: 20 * time.Millisecond, gauge: g},
+		slowFetcher{name: "d", delay: 0, gauge: g},
+	}
+	results := FetchAll(context.Background(), fetchers, 2)
+
+	if g.max != 2 {
+		t.Errorf("got %d fetchers running at once, want 2", g.max)
+	}
+	want := []Slab{{Lot: "a"}, {Lot: "b"}, {Lot: "c"}, {Lot: "d"}}
+	if diff := cmp.Diff(want, results.Slabs()); diff != "" {
+		t.Errorf("merged slabs not in fetcher order:\n%s", diff)
+	}
+	for i, r := range results {
+		if r.Fetcher != fetchers[i].Name() {
+			t.Errorf("result %d is from %q, want %q", i, r.Fetcher, fetchers[i].Name())
+		}
+		if r.Duration < fetchers[i].(slowFetcher).delay {
+			t.Errorf("%s: Duration %s is shorter than the fetch", r.Fetcher, r.Duration)
+		}
+	}
+	if results[1].Err != failure {
+		t.Errorf("got err %v from %q, want %v", results[1].Err, results[1].Fetcher, failure)
+	}
+}
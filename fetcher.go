@@ -0,0 +1,67 @@
+package slabfinder
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Fetcher retrieves the currently available slabs from one distributor.
+type Fetcher interface {
+	// Name is a short, unique, lowercase identifier, eg. "cosmos"
+	Name() string
+	// Vendor is the distributor whose slabs this Fetcher returns
+	Vendor() Vendor
+	// Fetch consults the distributor and returns the slabs in stock.  It
+	// should give up promptly when ctx is canceled.
+	Fetch(ctx context.Context) ([]Slab, error)
+}
+
+// Configurable is implemented by Fetchers which accept settings, such as
+// which product pages to consult, from the slabwatcher config file.  decode
+// unmarshals the Fetcher's section of the file into the value passed to it.
+type Configurable interface {
+	Configure(decode func(v interface{}) error) error
+}
+
+var (
+	fetchersMu sync.RWMutex
+	fetchers   = make(map[string]Fetcher)
+)
+
+// Register makes a Fetcher available to the watcher.  It is intended to be
+// called from the init function of each fetcher package.  Register panics if
+// it is called twice with the same name, or with a nil Fetcher.
+func Register(f Fetcher) {
+	if f == nil {
+		panic("slabfinder: Register fetcher is nil")
+	}
+	fetchersMu.Lock()
+	defer fetchersMu.Unlock()
+	name := f.Name()
+	if _, dup := fetchers[name]; dup {
+		panic(fmt.Sprintf("slabfinder: Register called twice for fetcher %q", name))
+	}
+	fetchers[name] = f
+}
+
+// Fetchers returns all the registered Fetchers, sorted by name.
+func Fetchers() []Fetcher {
+	fetchersMu.RLock()
+	defer fetchersMu.RUnlock()
+	var fs []Fetcher
+	for _, f := range fetchers {
+		fs = append(fs, f)
+	}
+	sort.Slice(fs, func(i, j int) bool { return fs[i].Name() < fs[j].Name() })
+	return fs
+}
+
+// LookupFetcher returns the registered Fetcher with the given name.
+func LookupFetcher(name string) (Fetcher, bool) {
+	fetchersMu.RLock()
+	defer fetchersMu.RUnlock()
+	f, ok := fetchers[name]
+	return f, ok
+}
@@ -0,0 +1,13 @@
+// Package all registers every known slab fetcher with slabfinder.
+//
+// Import it for its side effects:
+//
+//	import _ "github.com/asjoyner/slabfinder/fetcher/all"
+package all
+
+import (
+	// Each fetcher registers itself in its init function.
+	_ "github.com/asjoyner/slabfinder/fetcher/cosmos"
+	_ "github.com/asjoyner/slabfinder/fetcher/ohm"
+	_ "github.com/asjoyner/slabfinder/fetcher/stonebasyx"
+)
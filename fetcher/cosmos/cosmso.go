@@ -1,14 +1,15 @@
 package cosmos
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
 )
 
 // SlabPage defines the data necessary to fetch the Angular JSON data for types of slabs in a particular location
@@ -42,33 +43,109 @@ var (
 	}
 )
 
-// Fetch consults all the Cosmos pages and returns the currently available slabs.
-func Fetch() ([]slabfinder.Slab, error) {
+func init() {
+	slabfinder.Register(&fetcher{pages: pages})
+}
+
+// fetcher implements slabfinder.Fetcher for Cosmos.
+type fetcher struct {
+	pages []SlabPage
+}
+
+func (*fetcher) Name() string              { return "cosmos" }
+func (*fetcher) Vendor() slabfinder.Vendor { return slabfinder.Cosmos }
+func (f *fetcher) Fetch(ctx context.Context) ([]slabfinder.Slab, error) {
+	return fetch(ctx, f.pages)
+}
+
+// Config is the cosmos section of the slabwatcher config file.
+type Config struct {
+	Pages []PageConfig `yaml:"pages"`
+}
+
+// PageConfig describes a SlabPage in the config file.
+type PageConfig struct {
+	Name         string `yaml:"name"`
+	FetchURL     string `yaml:"fetch_url"`
+	PostData     string `yaml:"post_data"`
+	LinkURL      string `yaml:"link_url"`
+	PhotoBaseURL string `yaml:"photo_base_url"`
+	Finish       string `yaml:"finish"`
+}
+
+// Configure replaces the default pages with those from the config file.
+func (f *fetcher) Configure(decode func(v interface{}) error) error {
+	var c Config
+	if err := decode(&c); err != nil {
+		return err
+	}
+	var ps []SlabPage
+	for i, pc := range c.Pages {
+		if pc.Name == "" {
+			return fmt.Errorf("page %d has no name", i)
+		}
+		if u, err := url.Parse(pc.FetchURL); err != nil || u.Host == "" {
+			return fmt.Errorf("page %q: invalid fetch_url: %q", pc.Name, pc.FetchURL)
+		}
+		finish, err := slabfinder.ParseFinish(pc.Finish)
+		if err != nil {
+			return fmt.Errorf("page %q: %s", pc.Name, err)
+		}
+		ps = append(ps, SlabPage{
+			Name:         pc.Name,
+			FetchURL:     pc.FetchURL,
+			PostData:     pc.PostData,
+			LinkURL:      pc.LinkURL,
+			PhotoBaseURL: pc.PhotoBaseURL,
+			Finish:       finish,
+		})
+	}
+	if len(ps) > 0 {
+		f.pages = ps
+	}
+	return nil
+}
+
+// Fetch consults all the Cosmos pages and returns the currently available
+// slabs.  If any page fails, the slabs from the other pages are returned along
+// with a *slabfinder.FetchError describing the failures.
+func Fetch(ctx context.Context) ([]slabfinder.Slab, error) {
+	return fetch(ctx, pages)
+}
+
+func fetch(ctx context.Context, pages []SlabPage) ([]slabfinder.Slab, error) {
 	var slabs []slabfinder.Slab
+	errs := &slabfinder.FetchError{Attempted: len(pages)}
+	var reqs []*http.Request
+	var fetched []SlabPage
 	for _, page := range pages {
 		req, err := http.NewRequest("POST", page.FetchURL, strings.NewReader(page.PostData))
+		if err != nil {
+			errs.Add(page.FetchURL, 0, slabfinder.PhaseFetch, err).Page = page.Name
+			continue
+		}
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		req.Header.Add("x-requested-with", "XMLHttpRequest")
 		//o, _ := httputil.DumpRequestOut(req, true)
 		//fmt.Println(string(o))
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			fmt.Errorf("fetching URL: %s", err)
+		reqs = append(reqs, req)
+		fetched = append(fetched, page)
+	}
+	results := webclient.Default.DoAll(ctx, reqs)
+	for i, page := range fetched {
+		if results[i].Err != nil {
+			results[i].Err.Page = page.Name // the pages share a FetchURL
+			errs.Pages = append(errs.Pages, results[i].Err)
 			continue
 		}
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
+		slabSubset, err := parseJSON(results[i].Body, page)
 		if err != nil {
-			fmt.Errorf("reading Body: %s", err)
+			errs.Add(page.FetchURL, http.StatusOK, slabfinder.PhaseParse, err).Page = page.Name
 			continue
 		}
-		slabSubset, err := parseJSON(body, page)
-		if err != nil {
-			return nil, err
-		}
 		slabs = append(slabs, slabSubset...)
 	}
-	return slabs, nil
+	return slabs, errs.ErrOrNil()
 }
 
 // JSONBody describes the body returned by the POST request
@@ -100,6 +177,9 @@ func parseJSON(body []byte, page SlabPage) ([]slabfinder.Slab, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal %s: %s", page.Name, err)
 	}
+	if len(resp.Slabs) == 0 {
+		return nil, fmt.Errorf("no api_data for %s", page.Name)
+	}
 	var slabs []slabfinder.Slab
 	for _, s := range resp.Slabs {
 		if s.LotBundlePicture == "" {
@@ -107,7 +187,7 @@ func parseJSON(body []byte, page SlabPage) ([]slabfinder.Slab, error) {
 		}
 		photoURL, err := url.JoinPath(page.PhotoBaseURL, s.LotBundlePicture)
 		if err != nil {
-			fmt.Errorf("invalid photo URL: %s", err)
+			return nil, fmt.Errorf("invalid photo URL: %s", err)
 		}
 		slab := slabfinder.Slab{
 			Finish: page.Finish,
@@ -117,8 +197,10 @@ func parseJSON(body []byte, page SlabPage) ([]slabfinder.Slab, error) {
 			Length: s.AvgSlabLength,
 			Count:  s.AvailableSlabs,
 			Vendor: slabfinder.Cosmos,
+			Key:    s.PSDUnique1 + "/" + s.BundleNumber,
 			URL:    page.LinkURL,
 			Photo:  photoURL,
+			Page:   page.Name,
 		}
 		slabs = append(slabs, slab)
 	}
@@ -30,7 +30,9 @@ func TestParseJSON(t *testing.T) {
 					Length: 130,
 					Count:  2,
 					Vendor: slabfinder.Cosmos,
+					Key:    "6656/1497U",
 					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
+					Page:   "Titanium",
 					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_6656_34969_1497U_A22.JPEG",
 				},
 				{
@@ -41,7 +43,9 @@ func TestParseJSON(t *testing.T) {
 					Length: 131.5,
 					Count:  4,
 					Vendor: slabfinder.Cosmos,
+					Key:    "8907/195320",
 					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
+					Page:   "Titanium",
 					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_8907_36889_195320.JPEG",
 				},
 				{
@@ -52,7 +56,9 @@ func TestParseJSON(t *testing.T) {
 					Length: 132,
 					Count:  5,
 					Vendor: slabfinder.Cosmos,
+					Key:    "8907/195323",
 					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
+					Page:   "Titanium",
 					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_8907_36889_195323.JPEG",
 				},
 				{
@@ -63,7 +69,9 @@ func TestParseJSON(t *testing.T) {
 					Length: 121.5,
 					Count:  5,
 					Vendor: slabfinder.Cosmos,
+					Key:    "8907/195523",
 					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
+					Page:   "Titanium",
 					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_8907_36889_195523.JPEG",
 				},
 				{
@@ -74,7 +82,9 @@ func TestParseJSON(t *testing.T) {
 					Length: 120.5,
 					Count:  2,
 					Vendor: slabfinder.Cosmos,
+					Key:    "6135/349986",
 					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
+					Page:   "Titanium",
 					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_6135_34021_349986.JPG",
 				},
 			},
@@ -102,6 +112,15 @@ func TestParseJSON(t *testing.T) {
 	return
 }
 
+// A response without api_data is an error, rather than every slab being gone.
+func TestParseEmpty(t *testing.T) {
+	for _, body := range []string{`{"status": 200}`, `{"status": 200, "api_data": []}`} {
+		if slabs, err := parseJSON([]byte(body), pages[0]); err == nil {
+			t.Errorf("parseJSON(%s) = %v, want an error", body, slabs)
+		}
+	}
+}
+
 /*
 func TestParseFetch(t *testing.T) {
 	t.Log(Fetch())
@@ -1,73 +1,91 @@
 package ohm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
 )
 
-// SlabPage defines the data necessary to fetch the Angular JSON data for types of slabs in a particular location
-type SlabPage struct {
-	Name     string
-	FetchURL string
-	Finish   slabfinder.Finish
+const (
+	// galleryURL returns the metadata about every type of item OHM stocks
+	galleryURL = "https://ohm.stoneprofits.com/FetchDataWebV1.ashx?act=getItemGallery&InventoryGroupBy=IDTwo_&SearchbyItemIdentifiers=on&ShowFeatureProductOnTop=null&OnHold=null&OnSO=null&Intransit=null&showNotInStock=null&SearchbyFinish=on&SearchbySKU=on&Alphabet="
+	// inventoryURL returns the individual lots of one item type, by ItemID
+	inventoryURL = "https://ohm.stoneprofits.com/FetchDataWebV1.ashx?act=getItemInventory&id=%d&InventoryGroupBy=IDTwo_&TrimmedUserID=4932186393528091&OnHold=null&OnSO=null&Intransit=null&SelectedLocation=&ShowLocationinGallery=on&LotPicturesRestrictToSIPL=False&ShowOnlyFullInventoryImages=on"
+	// photoBaseURL is prepended to the FileName of each lot
+	photoBaseURL = "https://production123files.stoneprofits.com/Files/OHM"
+	// linkBaseURL is the human readable inventory site.  Detail pages are like
+	// https://inventory.ohmintl.com/CALCATTA-QUARTZITE-3CM-LEATHERED/4683/Location
+	// where CALCA.. is ItemName with dashes, and 4683 is ItemID
+	linkBaseURL = "https://inventory.ohmintl.com"
+)
+
+func init() {
+	slabfinder.Register(&fetcher{})
 }
 
-var (
-	pages = []SlabPage{
-		{
-			Name:     "AllSlabs",
-			FetchURL: "https://ohm.stoneprofits.com/FetchDataWebV1.ashx?act=getItemGallery&InventoryGroupBy=IDTwo_&SearchbyItemIdentifiers=on&ShowFeatureProductOnTop=null&OnHold=null&OnSO=null&Intransit=null&showNotInStock=null&SearchbyFinish=on&SearchbySKU=on&Alphabet=",
-			Finish:   slabfinder.Polished,
-		},
-		/*
-			// This just fetches Copacabana slabs, which is a bit faster, but less flexible
-			{
-				Name:         "Copacabana",
-				FetchURL:     "https://ohm.stoneprofits.com/FetchDataWebV1.ashx?act=getItemInventory&id=5181&InventoryGroupBy=IDTwo_&TrimmedUserID=4932186393528091&OnHold=null&OnSO=null&Intransit=null&SelectedLocation=&ShowLocationinGallery=on&LotPicturesRestrictToSIPL=False&ShowOnlyFullInventoryImages=on",
-				Finish:       slabfinder.Polished,
-			},
-		*/
-	}
-)
+// fetcher implements slabfinder.Fetcher for OHM.
+type fetcher struct{}
 
-// LinkURL is like https://inventory.ohmintl.com/CALCATTA-QUARTZITE-3CM-LEATHERED/4683/Location
-// where CALCA.. is ItemName with dashes, and 4683 is ItemID
-// PhotoBaseURL is always https://production123files.stoneprofits.com/Files/OHM
+func (*fetcher) Name() string              { return "ohm" }
+func (*fetcher) Vendor() slabfinder.Vendor { return slabfinder.OHM }
+func (*fetcher) Fetch(ctx context.Context) ([]slabfinder.Slab, error) {
+	return Fetch(ctx)
+}
 
-// Fetch consults all the OHM pages and returns the currently available slabs.
-func Fetch() ([]slabfinder.Slab, error) {
+// Fetch consults the OHM item gallery, then the inventory of each item in it,
+// and returns the currently available slabs.  If any page fails, the slabs
+// from the other pages are returned along with a *slabfinder.FetchError
+// describing the failures.
+func Fetch(ctx context.Context) ([]slabfinder.Slab, error) {
+	return fetch(ctx, galleryURL, inventoryURL)
+}
+
+func fetch(ctx context.Context, galleryURL, inventoryURL string) ([]slabfinder.Slab, error) {
+	errs := &slabfinder.FetchError{Attempted: 1}
+	body, perr := webclient.Default.Get(ctx, galleryURL)
+	if perr != nil {
+		errs.Pages = append(errs.Pages, perr)
+		return nil, errs
+	}
+	slabTypes, err := parseGallery(body)
+	if err != nil {
+		errs.Add(galleryURL, http.StatusOK, slabfinder.PhaseParse, err)
+		return nil, errs
+	}
+	var urls []string
+	for _, slabType := range slabTypes {
+		urls = append(urls, fmt.Sprintf(inventoryURL, slabType.ItemID))
+	}
+	// The gallery succeeded, so the vendor is unreachable if every
+	// inventory page fails.
+	errs.Attempted = len(urls)
+	results := webclient.Default.GetAll(ctx, urls)
 	var slabs []slabfinder.Slab
-	for _, page := range pages {
-		resp, err := http.Get(page.FetchURL)
-		if err != nil {
-			fmt.Errorf("fetching URL: %s", err)
+	for i, slabType := range slabTypes {
+		if results[i].Err != nil {
+			errs.Pages = append(errs.Pages, results[i].Err)
 			continue
 		}
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
+		slabSubset, err := parseInventory(results[i].Body, slabType)
 		if err != nil {
-			fmt.Errorf("reading Body: %s", err)
+			errs.Add(urls[i], http.StatusOK, slabfinder.PhaseParse, err)
 			continue
 		}
-		slabSubset, err := parseJSON(body, page)
-		if err != nil {
-			return nil, err
+		for _, slab := range slabSubset {
+			slab.Page = urls[i]
+			slabs = append(slabs, slab)
 		}
-		slabs = append(slabs, slabSubset...)
 	}
-	return slabs, nil
+	return slabs, errs.ErrOrNil()
 }
 
-// SlabLotsJSONBody describes the body returned by the POST request
-type SlabLotsJSONBody struct {
-	SlabLot []SlabLot
-}
-
-// SlabLot describes one lot of slabs found at this page
+// SlabLot describes one lot of slabs of a given SlabType, at one location
 type SlabLot struct {
 	SELECTEDLocation string
 	CategoryName     string
@@ -80,9 +98,9 @@ type SlabLot struct {
 	LocationID       int
 	CustomID         int
 	FileID           string
-	AverageLength    int
-	AverageWidth     int
-	AvailableQty     int
+	AverageLength    float64
+	AverageWidth     float64
+	AvailableQty     float64
 	UOM              string
 	AvailableSlabs   int
 	WebCartID        int
@@ -90,12 +108,8 @@ type SlabLot struct {
 	Totalrows        string
 }
 
-// SlabTypesJSONBody describes the body returned by the POST request
-type SlabTypesJSONBody struct {
-	SlabType []SlabType
-}
-
-// SlabType describes one lot of slabs found at this page
+// SlabType describes one type of item in the gallery, eg. a color and
+// thickness of granite.
 type SlabType struct {
 	Totalrows            string
 	ItemID               int
@@ -119,7 +133,7 @@ type SlabType struct {
 	PriceRangeID         int
 	GroupID              int `json:",string"`
 	ThicknessID          int
-	Thickness            int `json:",string"`
+	Thickness            float64 `json:",string"`
 	ThicknessUOM         string
 	ColorID              int `json:",string"`
 	Finish               int
@@ -129,34 +143,84 @@ type SlabType struct {
 	IDTwo                int `json:",string"`
 }
 
-func parseJSON(body []byte, page SlabPage) ([]slabfinder.Slab, error) {
-	var resp SlabTypesJSONBody
-	err := json.Unmarshal(body, &resp)
+func parseGallery(body []byte) ([]SlabType, error) {
+	var slabTypes []SlabType
+	if err := json.Unmarshal(body, &slabTypes); err != nil {
+		return nil, fmt.Errorf("unmarshal gallery: %s", err)
+	}
+	if len(slabTypes) == 0 {
+		return nil, fmt.Errorf("empty gallery")
+	}
+	return slabTypes, nil
+}
+
+func parseInventory(body []byte, slabType SlabType) ([]slabfinder.Slab, error) {
+	var lots []SlabLot
+	if err := json.Unmarshal(body, &lots); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %s", slabType.ItemName, err)
+	}
+	if len(lots) == 0 {
+		return nil, fmt.Errorf("no lots of %s", slabType.ItemName)
+	}
+	link, err := url.JoinPath(linkBaseURL, linkName(slabType.ItemName), fmt.Sprint(slabType.ItemID), "Location")
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal %s: %s", page.Name, err)
+		return nil, fmt.Errorf("invalid link URL: %s", err)
 	}
 	var slabs []slabfinder.Slab
-	for _, s := range resp.SlabType {
-		if s.LotBundlePicture == "" {
+	for _, s := range lots {
+		// The gallery also lists tile, sinks, etc.
+		if s.ProductFormValue != "" && !strings.EqualFold(s.ProductFormValue, "SLAB") {
 			continue
 		}
-		//photoURL, err := url.JoinPath(page.PhotoBaseURL, s.LotBundlePicture)
-		if err != nil {
-			fmt.Errorf("invalid photo URL: %s", err)
-		}
 		slab := slabfinder.Slab{
-			Finish: page.Finish,
-			Lot:    s.LotNumber,
-			Bundle: s.BundleNumber,
-			Width:  s.AvgSlabWidth,
-			Length: s.AvgSlabLength,
-			Count:  s.AvailableSlabs,
-			Vendor: slabfinder.Cosmos,
-			//URL:    page.LinkURL,
-			//Photo: photoURL,
+			Color:     slabType.Color,
+			Finish:    parseFinish(slabType.ItemName),
+			Thickness: thickness(slabType),
+			Lot:       s.IDTwo,
+			Bundle:    s.IDTwo,
+			Width:     s.AverageWidth,
+			Length:    s.AverageLength,
+			Count:     s.AvailableSlabs,
+			Location:  s.Location,
+			Vendor:    slabfinder.OHM,
+			Key:       s.IDTwo + "/" + s.Location, // the same IDTwo can be in several warehouses
+			URL:       link,
+		}
+		if s.FileName != "" {
+			slab.Photo, err = url.JoinPath(photoBaseURL, s.FileName)
+			if err != nil {
+				return nil, fmt.Errorf("invalid photo URL: %s", err)
+			}
 		}
 		slabs = append(slabs, slab)
 	}
-
 	return slabs, nil
 }
+
+// linkName converts an ItemName like "CALCATTA QUARTZITE 3CM LEATHERED" into
+// the form used in inventory.ohmintl.com URLs, "CALCATTA-QUARTZITE-3CM-LEATHERED"
+func linkName(itemName string) string {
+	return strings.Join(strings.Fields(itemName), "-")
+}
+
+// parseFinish guesses the finish from the ItemName, which is where OHM
+// describes it, eg. "CALCATTA QUARTZITE 3CM LEATHERED".  Items without a
+// finish in their name are polished.
+func parseFinish(itemName string) slabfinder.Finish {
+	name := strings.ToUpper(itemName)
+	switch {
+	case strings.Contains(name, "LEATHER"):
+		return slabfinder.Leather
+	case strings.Contains(name, "HONED"):
+		return slabfinder.Honed
+	}
+	return slabfinder.Polished
+}
+
+// thickness returns the thickness of the SlabType in CM
+func thickness(slabType SlabType) float64 {
+	if strings.EqualFold(slabType.ThicknessUOM, "MM") {
+		return slabType.Thickness / 10
+	}
+	return slabType.Thickness
+}
@@ -1,81 +1,112 @@
 package ohm
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
 	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
 	"github.com/google/go-cmp/cmp"
 )
 
-func TestParseJSON(t *testing.T) {
+func TestParseInventory(t *testing.T) {
 	type test struct {
 		name     string
-		input    string   // path to an html file
-		SlabPage SlabPage // Metadata about the request
+		input    string   // path to a JSON file
+		SlabType SlabType // Metadata about the item, from the gallery
 		want     []slabfinder.Slab
 	}
 
+	link := "https://inventory.ohmintl.com/COPACABANA-WHITE-3CM/5181/Location"
 	tests := []test{
 		{
-			name:     "Classic",
-			input:    "testdata/titanium.charlotte.json",
-			SlabPage: pages[0],
+			name:  "Copacabana",
+			input: "testdata/copacabana.white.3cm.json",
+			SlabType: SlabType{
+				ItemID:       5181,
+				ItemName:     "COPACABANA WHITE 3CM",
+				Color:        "White",
+				Thickness:    3,
+				ThicknessUOM: "CM",
+			},
 			want: []slabfinder.Slab{
 				{
-					Finish: slabfinder.Polished,
-					Lot:    "6656",
-					Bundle: "1497U",
-					Width:  77.5,
-					Length: 130,
-					Count:  2,
-					Vendor: slabfinder.Cosmos,
-					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
-					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_6656_34969_1497U_A22.JPEG",
+					Color:     "White",
+					Finish:    slabfinder.Polished,
+					Thickness: 3,
+					Lot:       "44272B",
+					Bundle:    "44272B",
+					Width:     66,
+					Length:    117,
+					Count:     4,
+					Location:  "Nashville, TN",
+					Vendor:    slabfinder.OHM,
+					Key:       "44272B/Nashville, TN",
+					URL:       link,
+					Photo:     "https://production123files.stoneprofits.com/Files/OHM/Copacabana_White_Lot_44272B_Full_321661.jpg",
 				},
 				{
-					Finish: slabfinder.Polished,
-					Lot:    "8907",
-					Bundle: "195320",
-					Width:  77.5,
-					Length: 131.5,
-					Count:  4,
-					Vendor: slabfinder.Cosmos,
-					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
-					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_8907_36889_195320.JPEG",
+					Color:     "White",
+					Finish:    slabfinder.Polished,
+					Thickness: 3,
+					Lot:       "46420",
+					Bundle:    "46420",
+					Width:     79,
+					Length:    120,
+					Count:     2,
+					Location:  "Columbus, OH",
+					Vendor:    slabfinder.OHM,
+					Key:       "46420/Columbus, OH",
+					URL:       link,
+					Photo:     "https://production123files.stoneprofits.com/Files/OHM/Copacabana_White_3cm_46420_Full_427223.jpg",
 				},
 				{
-					Finish: slabfinder.Polished,
-					Lot:    "8907",
-					Bundle: "195323",
-					Width:  77,
-					Length: 132,
-					Count:  5,
-					Vendor: slabfinder.Cosmos,
-					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
-					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_8907_36889_195323.JPEG",
+					Color:     "White",
+					Finish:    slabfinder.Polished,
+					Thickness: 3,
+					Lot:       "46420",
+					Bundle:    "46420",
+					Width:     78,
+					Length:    119,
+					Count:     1,
+					Location:  "Madison, AL",
+					Vendor:    slabfinder.OHM,
+					Key:       "46420/Madison, AL",
+					URL:       link,
+					Photo:     "https://production123files.stoneprofits.com/Files/OHM/Copacabana_White_3cm_46420_Full_427223.jpg",
 				},
 				{
-					Finish: slabfinder.Polished,
-					Lot:    "8907",
-					Bundle: "195523",
-					Width:  75.5,
-					Length: 121.5,
-					Count:  5,
-					Vendor: slabfinder.Cosmos,
-					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
-					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_8907_36889_195523.JPEG",
+					Color:     "White",
+					Finish:    slabfinder.Polished,
+					Thickness: 3,
+					Lot:       "46420",
+					Bundle:    "46420",
+					Width:     79,
+					Length:    120,
+					Count:     1,
+					Location:  "Monroe, NJ",
+					Vendor:    slabfinder.OHM,
+					Key:       "46420/Monroe, NJ",
+					URL:       link,
+					Photo:     "https://production123files.stoneprofits.com/Files/OHM/Copacabana_White_3cm_46420_Full_427223.jpg",
 				},
 				{
-					Finish: slabfinder.Polished,
-					Lot:    "6135",
-					Bundle: "349986",
-					Width:  75,
-					Length: 120.5,
-					Count:  2,
-					Vendor: slabfinder.Cosmos,
-					URL:    "https://www.cosmosgranite.com/charlotte/granite/charlotte-293-titanium",
-					Photo:  "https://cosmosgranite.nyc3.digitaloceanspaces.com/img/live_inventory/charlotte_charleston/LotImg_Titanium_6135_34021_349986.JPG",
+					Color:     "White",
+					Finish:    slabfinder.Polished,
+					Thickness: 3,
+					Lot:       "46420",
+					Bundle:    "46420",
+					Width:     78,
+					Length:    114,
+					Count:     7,
+					Location:  "Nashville, TN",
+					Vendor:    slabfinder.OHM,
+					Key:       "46420/Nashville, TN",
+					URL:       link,
+					Photo:     "https://production123files.stoneprofits.com/Files/OHM/Copacabana_White_3cm_46420_Full_427223.jpg",
 				},
 			},
 		},
@@ -88,7 +119,7 @@ func TestParseJSON(t *testing.T) {
 			continue
 		}
 
-		got, err := parseJSON(page, tc.SlabPage)
+		got, err := parseInventory(page, tc.SlabType)
 		if err != nil {
 			t.Errorf("%s: parsing %s: %s", tc.name, tc.input, err)
 			continue
@@ -102,6 +133,212 @@ func TestParseJSON(t *testing.T) {
 	return
 }
 
+func TestParseGallery(t *testing.T) {
+	type test struct {
+		name    string
+		input   string // path to a JSON file
+		want    []SlabType
+		wantErr bool
+	}
+
+	tests := []test{
+		{
+			name:  "Gallery",
+			input: "testdata/allSlabs.json",
+			want: []SlabType{
+				{
+					Totalrows:     "3",
+					ItemID:        4683,
+					ItemName:      "CALCATTA QUARTZITE 3CM LEATHERED",
+					SKU:           "CALQTZ3LTH",
+					Origin:        21,
+					Type:          "Quartzite",
+					TypeID:        7,
+					Color:         "White",
+					Filename:      "Calcatta_Quartzite_3cm_Leathered_Full_300112.jpg",
+					CategoryName:  "Natural Stone",
+					CategoryID:    1,
+					SubCategory:   "Quartzite",
+					SubCategoryID: 7,
+					PriceRange:    "Level 5",
+					PriceRangeID:  5,
+					GroupID:       3,
+					ThicknessID:   2,
+					Thickness:     3,
+					ThicknessUOM:  "CM",
+					ColorID:       11,
+					Finish:        2,
+					OriginID:      21,
+					Kind:          "Item",
+				},
+				{
+					Totalrows:            "3",
+					ItemID:               5181,
+					ItemName:             "COPACABANA WHITE 3CM",
+					SKU:                  "COPWHT3",
+					AlternateName:        "Copacabana",
+					DescriptiononWebsite: "A white granite with black veining",
+					Origin:               21,
+					Type:                 "Granite",
+					TypeID:               1,
+					Color:                "White",
+					NewArrival:           "Yes",
+					Filename:             "Copacabana_White_Lot_44272B_Full_321661.jpg",
+					CategoryName:         "Natural Stone",
+					CategoryID:           1,
+					SubCategory:          "Granite",
+					SubCategoryID:        1,
+					PriceRange:           "Level 3",
+					PriceRangeID:         3,
+					GroupID:              1,
+					ThicknessID:          2,
+					Thickness:            3,
+					ThicknessUOM:         "CM",
+					ColorID:              11,
+					Finish:               1,
+					OriginID:             21,
+					Kind:                 "Item",
+					FeatureProduct:       "Yes",
+				},
+				{
+					Totalrows:     "3",
+					ItemID:        6012,
+					ItemName:      "ABSOLUTE BLACK HONED 20MM",
+					SKU:           "ABSBLK20H",
+					Origin:        9,
+					Type:          "Granite",
+					TypeID:        1,
+					Color:         "Black",
+					CategoryName:  "Natural Stone",
+					CategoryID:    1,
+					SubCategory:   "Granite",
+					SubCategoryID: 1,
+					PriceRange:    "Level 2",
+					PriceRangeID:  2,
+					GroupID:       1,
+					ThicknessID:   1,
+					Thickness:     20,
+					ThicknessUOM:  "MM",
+					ColorID:       2,
+					Finish:        3,
+					OriginID:      9,
+					Kind:          "Item",
+				},
+			},
+		},
+		{
+			name:    "Inventory",
+			input:   "testdata/copacabana.white.3cm.json",
+			wantErr: true, // its IDTwo are lot numbers like "44272B"
+		},
+	}
+
+	for _, tc := range tests {
+		page, err := os.ReadFile(tc.input)
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+
+		got, err := parseGallery(page)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: parsing %s: error %v, want an error: %t", tc.name, tc.input, err, tc.wantErr)
+			continue
+		}
+
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s:\n%s", tc.name, diff)
+			continue
+		}
+	}
+
+	// The gallery is all the fetcher knows about each item's thickness and
+	// finish.
+	slabTypes, err := parseGallery([]byte(`[{"ItemName": "ABSOLUTE BLACK HONED 20MM", "Thickness": "20", "ThicknessUOM": "MM"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := thickness(slabTypes[0]); got != 2 {
+		t.Errorf("thickness = %v, want 2", got)
+	}
+	if got := parseFinish(slabTypes[0].ItemName); got != slabfinder.Honed {
+		t.Errorf("finish = %s, want Honed", got)
+	}
+}
+
+func TestFetchUnreachable(t *testing.T) {
+	gallery, err := os.ReadFile("testdata/allSlabs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory, err := os.ReadFile("testdata/copacabana.white.3cm.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up map[string]bool // the items whose inventory can be fetched
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gallery":
+			w.Write(gallery)
+		case up[r.URL.Query().Get("id")]:
+			w.Write(inventory)
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	policy := webclient.Default.Policy
+	defer func() { webclient.Default.Policy = policy }()
+	webclient.Default.Policy.MaxAttempts = 1
+
+	tests := []struct {
+		up              map[string]bool
+		wantUnreachable bool
+	}{
+		{map[string]bool{}, true},
+		{map[string]bool{"5181": true}, false},
+	}
+	for _, tc := range tests {
+		up = tc.up
+		slabs, err := fetch(context.Background(), ts.URL+"/gallery", ts.URL+"/inventory?id=%d")
+		if err == nil {
+			t.Errorf("%v: no error", tc.up)
+		}
+		if got := slabfinder.Unreachable(err); got != tc.wantUnreachable {
+			t.Errorf("%v: Unreachable(%v) = %t, want %t", tc.up, err, got, tc.wantUnreachable)
+		}
+		if tc.wantUnreachable == (len(slabs) > 0) {
+			t.Errorf("%v: got %d slabs", tc.up, len(slabs))
+		}
+	}
+}
+
+func TestParseFinish(t *testing.T) {
+	tests := map[string]slabfinder.Finish{
+		"COPACABANA WHITE 3CM":             slabfinder.Polished,
+		"CALCATTA QUARTZITE 3CM LEATHERED": slabfinder.Leather,
+		"Absolute Black Honed 2cm":         slabfinder.Honed,
+	}
+	for name, want := range tests {
+		if got := parseFinish(name); got != want {
+			t.Errorf("parseFinish(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+// An empty gallery or inventory is an error, rather than every slab being
+// gone.
+func TestParseEmpty(t *testing.T) {
+	for _, body := range []string{"[]", "null"} {
+		if slabTypes, err := parseGallery([]byte(body)); err == nil {
+			t.Errorf("parseGallery(%s) = %v, want an error", body, slabTypes)
+		}
+		if slabs, err := parseInventory([]byte(body), SlabType{ItemName: "COPACABANA WHITE 3CM"}); err == nil {
+			t.Errorf("parseInventory(%s) = %v, want an error", body, slabs)
+		}
+	}
+}
+
 /*
 func TestParseFetch(t *testing.T) {
 	t.Log(Fetch())
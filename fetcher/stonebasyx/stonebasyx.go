@@ -3,15 +3,15 @@ package stonebasyx
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
 )
 
 var (
@@ -31,28 +31,69 @@ var (
 	}
 )
 
-// Fetch consults all the StoneBasyx pages and returns the currently available slabs.
-func Fetch() ([]slabfinder.Slab, error) {
+func init() {
+	slabfinder.Register(&fetcher{pages: slabTypes})
+}
+
+// fetcher implements slabfinder.Fetcher for StoneBasyx.
+type fetcher struct {
+	pages []string
+}
+
+func (*fetcher) Name() string              { return "stonebasyx" }
+func (*fetcher) Vendor() slabfinder.Vendor { return slabfinder.StoneBasyx }
+func (f *fetcher) Fetch(ctx context.Context) ([]slabfinder.Slab, error) {
+	return fetch(ctx, f.pages)
+}
+
+// Config is the stonebasyx section of the slabwatcher config file.
+type Config struct {
+	// Pages are product-details URLs, like the ones in slabTypes
+	Pages []string `yaml:"pages"`
+}
+
+// Configure replaces the default pages with those from the config file.
+func (f *fetcher) Configure(decode func(v interface{}) error) error {
+	var c Config
+	if err := decode(&c); err != nil {
+		return err
+	}
+	for _, page := range c.Pages {
+		if u, err := url.Parse(page); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid page URL: %q", page)
+		}
+	}
+	if len(c.Pages) > 0 {
+		f.pages = c.Pages
+	}
+	return nil
+}
+
+// Fetch consults all the StoneBasyx pages and returns the currently available
+// slabs.  If any page fails, the slabs from the other pages are returned along
+// with a *slabfinder.FetchError describing the failures.
+func Fetch(ctx context.Context) ([]slabfinder.Slab, error) {
+	return fetch(ctx, slabTypes)
+}
+
+func fetch(ctx context.Context, pages []string) ([]slabfinder.Slab, error) {
 	var slabs []slabfinder.Slab
-	for _, url := range slabTypes {
-		resp, err := http.Get(url)
-		if err != nil {
-			fmt.Errorf("fetching URL: %s", err)
+	errs := &slabfinder.FetchError{}
+	results := webclient.Default.GetAll(ctx, pages)
+	for i, url := range pages {
+		errs.Attempted++
+		if results[i].Err != nil {
+			errs.Pages = append(errs.Pages, results[i].Err)
 			continue
 		}
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
+		slabSubset, err := parseHTML(results[i].Body, url)
 		if err != nil {
-			fmt.Errorf("reading Body: %s", err)
+			errs.Add(url, http.StatusOK, slabfinder.PhaseParse, err)
 			continue
 		}
-		slabSubset, err := parseHTML(body, url)
-		if err != nil {
-			return nil, err
-		}
 		slabs = append(slabs, slabSubset...)
 	}
-	return slabs, nil
+	return slabs, errs.ErrOrNil()
 }
 
 func parseHTML(page []byte, fetchURL string) ([]slabfinder.Slab, error) {
@@ -60,8 +101,10 @@ func parseHTML(page []byte, fetchURL string) ([]slabfinder.Slab, error) {
 	var color string
 	var finish slabfinder.Finish
 	var thickness float64
+	var location string
 	var foundContent bool
 	var err error
+	product := productID(fetchURL)
 	scanner := bufio.NewScanner(bytes.NewReader(page))
 	scanner.Buffer(make([]byte, 0), 512*1024)
 	for scanner.Scan() {
@@ -107,6 +150,11 @@ func parseHTML(page []byte, fetchURL string) ([]slabfinder.Slab, error) {
 			}
 		}
 
+		// The lots are listed under the warehouse which has them
+		if strings.Contains(line, "In Stock In ") {
+			location = strings.Split(strings.SplitN(line, "In Stock In ", 2)[1], "<")[0]
+		}
+
 		// Parse out each lot of slabs on the page
 		if strings.Contains(line, "class=\"thumbpicsm2017\"") {
 			slab := slabfinder.Slab{
@@ -114,6 +162,7 @@ func parseHTML(page []byte, fetchURL string) ([]slabfinder.Slab, error) {
 				Color:     color,
 				Finish:    finish,
 				Thickness: thickness,
+				Location:  location,
 			}
 			token := strings.Split(line, "\"")
 			if len(token) < 4 {
@@ -125,6 +174,7 @@ func parseHTML(page []byte, fetchURL string) ([]slabfinder.Slab, error) {
 			}
 			slab.Photo = strings.Split(urlWithSuffix, "?")[0]
 			slab.URL = fetchURL
+			slab.Page = fetchURL
 
 			scanner.Scan() // throw away a line
 			scanner.Scan() // fetch the second line
@@ -172,6 +222,8 @@ func parseHTML(page []byte, fetchURL string) ([]slabfinder.Slab, error) {
 			if slab.Count, err = strconv.Atoi(strings.TrimSuffix(count, " slabs")); err != nil {
 				return nil, fmt.Errorf("slab count invalid: %+v, %s", err, line)
 			}
+			// the same bundle can be in several warehouses
+			slab.Key = fmt.Sprintf("%s/%s/%s/%s", product, slab.Lot, slab.Bundle, location)
 
 			slabs = append(slabs, slab)
 		}
@@ -181,12 +233,33 @@ func parseHTML(page []byte, fetchURL string) ([]slabfinder.Slab, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		fmt.Fprintln(os.Stderr, "scanning the HTML page:", err)
+		return nil, fmt.Errorf("scanning the HTML page: %s", err)
+	}
+	// An empty page is more likely to be a change to its layout than a
+	// product which sold out, so it isn't taken as every slab being gone.
+	if !foundContent {
+		return nil, fmt.Errorf("no content marker in the HTML page")
+	}
+	if len(slabs) == 0 {
+		return nil, fmt.Errorf("no slabs in the HTML page")
 	}
 
 	return slabs, nil
 }
 
+// productID returns the selproductid parameter of a product page URL, or the
+// whole URL if it doesn't have one.
+func productID(fetchURL string) string {
+	u, err := url.Parse(fetchURL)
+	if err != nil {
+		return fetchURL
+	}
+	if id := u.Query().Get("selproductid"); id != "" {
+		return id
+	}
+	return fetchURL
+}
+
 // parseKey splits apart lines like this:
 // <strong style="padding-left:20px;">Color: <a style="padding-left:5px;">Black, White</a></strong>^M
 // and returns the string "Black, White"
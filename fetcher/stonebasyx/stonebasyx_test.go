@@ -31,9 +31,12 @@ func TestParseHTML(t *testing.T) {
 					Thickness: 3.0,
 					Length:    132.5,
 					Width:     78.5,
+					Location:  "Atlanta",
 					Vendor:    slabfinder.StoneBasyx,
+					Key:       "536/022632/127760/Atlanta",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-104-127760-MAORI%20-%203.00%20CM%20-%20022632%20-%20127760.JPEG",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -44,9 +47,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    119,
 					Count:     2,
+					Location:  "Atlanta",
 					Vendor:    1,
+					Key:       "536/102/13021/Atlanta",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13021-MAORI_Bund_13021_BLK_102_3cm_Premium_pic_34775.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -57,9 +63,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    129.5,
 					Count:     2,
+					Location:  "Charlotte",
 					Vendor:    1,
+					Key:       "536/17899/1789939/Charlotte",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-66-210783239-MAORI%20POLISHED_block017899%20%20%20%20_bundle210783239_3CM.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -70,9 +79,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     75.5,
 					Length:    129,
 					Count:     2,
+					Location:  "Charlotte",
 					Vendor:    1,
+					Key:       "536/17899/1789941/Charlotte",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-66-210783241-MAORI%20POLISHED_block017899%20%20%20%20_bundle210783241_3CM.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -83,9 +95,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    119.5,
 					Count:     1,
+					Location:  "Charlotte",
 					Vendor:    1,
+					Key:       "536/102/13026/Charlotte",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13026-MAORI_Bund_13026_BLK_102_3cm_Premium_pic_34871.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -96,9 +111,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     76.5,
 					Length:    131.5,
 					Count:     6,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/07/11348/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-270-11348-MAORI%203CM%20-%20SLABS%2009-14%20-%20BLK%20204.jpeg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -109,9 +127,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     70.5,
 					Length:    126,
 					Count:     4,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/20411/145807/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-100-145807-COPACABANA%20-%203CM%20-%20BLOCK%2020411.%20-%20SLABS%2016%20TO%2022.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -122,9 +143,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    119,
 					Count:     2,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/102/13020/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13020-MAORI_Bund_13020_BLK_102_3cm_Premium_pic_34780.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -135,9 +159,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    119,
 					Count:     2,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/102/13025/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13025-MAORI_Bund_13025_BLK_102_3cm_Premium_pic_34869.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -148,9 +175,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     71,
 					Length:    126,
 					Count:     2,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/20411/145809/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-100-145809-COPACABANA%20-%203CM%20-%20BLOCK%2020411.%20-%20SLABS%2023%20TO%2030.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -161,9 +191,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     75,
 					Length:    124,
 					Count:     1,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/021700/119453/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-104-119453-COPACABANA%20-%203.00%20CM%20-%20021700%20-%20119453.JPEG",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -174,9 +207,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    119,
 					Count:     1,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/102/13021/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13021-MAORI_Bund_13021_BLK_102_3cm_Premium_pic_34775.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -187,9 +223,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    129.5,
 					Count:     1,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/17899/1789939/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-66-210783239-MAORI%20POLISHED_block017899%20%20%20%20_bundle210783239_3CM.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -200,9 +239,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     75.5,
 					Length:    129.5,
 					Count:     1,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "536/17899/1789940/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-66-210783240-MAORI%20POLISHED_block017899%20%20%20%20_bundle210783240_3CM.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -213,9 +255,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     74,
 					Length:    123,
 					Count:     5,
+					Location:  "Knoxville",
 					Vendor:    1,
+					Key:       "536/75/7507/Knoxville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-267-007-MAORI%203cm%20Block%2075%20Slab%20033-037.JPG",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -226,9 +271,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     74,
 					Length:    123,
 					Count:     5,
+					Location:  "Knoxville",
 					Vendor:    1,
+					Key:       "536/75/7508/Knoxville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-267-008-MAORI%203cm%20Block%2075%20Slab%20038-042.JPG",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -239,9 +287,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     65.5,
 					Length:    125.5,
 					Count:     1,
+					Location:  "Knoxville",
 					Vendor:    1,
+					Key:       "536/20411/145806/Knoxville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-100-145806-COPACABANA%20-%203CM%20-%20BLOCK%2020411.%20-%20SLABS%2011%20TO%2015.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -252,9 +303,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     79.5,
 					Length:    131.5,
 					Count:     1,
+					Location:  "Knoxville",
 					Vendor:    1,
+					Key:       "536/000755/3369/Knoxville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-104-3369-Copacabana%20bundle%203369.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -265,9 +319,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    119,
 					Count:     3,
+					Location:  "Lexington",
 					Vendor:    1,
+					Key:       "536/102/13022/Lexington",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13022-MAORI_Bund_13022_BLK_102_3cm_Premium_pic_34786.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -278,9 +335,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     78,
 					Length:    120,
 					Count:     2,
+					Location:  "Lexington",
 					Vendor:    1,
+					Key:       "536/27/8404/Lexington",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-8404-MAORI_Bund_8404_BLK_27_3cm_Premium_pic0.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -291,9 +351,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     65.5,
 					Length:    125.5,
 					Count:     1,
+					Location:  "Lexington",
 					Vendor:    1,
+					Key:       "536/20411/145806/Lexington",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-100-145806-COPACABANA%20-%203CM%20-%20BLOCK%2020411.%20-%20SLABS%2011%20TO%2015.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -304,9 +367,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     78.5,
 					Length:    125,
 					Count:     7,
+					Location:  "Myrtle Beach",
 					Vendor:    1,
+					Key:       "536/9061/14991/Myrtle Beach",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-14991-MAORI%203CM%2014991.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -317,9 +383,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     78,
 					Length:    124.5,
 					Count:     7,
+					Location:  "Myrtle Beach",
 					Vendor:    1,
+					Key:       "536/9061/14993/Myrtle Beach",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-14993-MAORI%203CM%2014993.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -330,9 +399,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    132,
 					Count:     6,
+					Location:  "Myrtle Beach",
 					Vendor:    1,
+					Key:       "536/108/13384/Myrtle Beach",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13384-MAORI_Bund_13384_BLK_SKY108_3cm_Premium_pic_35507.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -343,9 +415,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    131.5,
 					Count:     6,
+					Location:  "Myrtle Beach",
 					Vendor:    1,
+					Key:       "536/108/13387/Myrtle Beach",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13387-MAORI_Bund_13387_BLK_SKY108_3cm_Premium_pic_35513.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -356,9 +431,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    132,
 					Count:     3,
+					Location:  "Myrtle Beach",
 					Vendor:    1,
+					Key:       "536/108/13385/Myrtle Beach",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13385-MAORI_Bund_13385_BLK_SKY108_3cm_Premium_pic_35509.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 				{
 					Color:     "Black, White",
@@ -369,9 +447,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    119,
 					Count:     1,
+					Location:  "Raleigh",
 					Vendor:    1,
+					Key:       "536/102/13021/Raleigh",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-115-13021-MAORI_Bund_13021_BLK_102_3cm_Premium_pic_34775.jpg",
 					URL:       slabTypes[0],
+					Page:      slabTypes[0],
 				},
 			},
 		},
@@ -389,9 +470,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    127.5,
 					Count:     6,
+					Location:  "Atlanta",
 					Vendor:    1,
+					Key:       "690/38651/358910/Atlanta",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/690-2-358910-BD%20358910%20BLK038651%20MAORI%20HONED%20SPECIAL.jpg",
 					URL:       slabTypes[1],
+					Page:      slabTypes[1],
 				},
 				{
 					Color:     "Black, White",
@@ -402,9 +486,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    127.5,
 					Count:     5,
+					Location:  "Atlanta",
 					Vendor:    1,
+					Key:       "690/38651/358911/Atlanta",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/690-2-358911-BD%20358911%20BLK038651%20MAORI%20HONED%20SPECIAL.jpg",
 					URL:       slabTypes[1],
+					Page:      slabTypes[1],
 				},
 				{
 					Color:     "Black, White",
@@ -415,9 +502,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    126.5,
 					Count:     6,
+					Location:  "Charlotte",
 					Vendor:    1,
+					Key:       "690/38651/358908/Charlotte",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/690-2-358908-BD%20358908%20BLK038651%20MAORI%20HONED%20SPECIAL.jpg",
 					URL:       slabTypes[1],
+					Page:      slabTypes[1],
 				},
 				{
 					Color:     "Black, White",
@@ -428,9 +518,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    127.5,
 					Count:     6,
+					Location:  "Charlotte",
 					Vendor:    1,
+					Key:       "690/38651/358909/Charlotte",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/690-2-358909-BD%20358909%20BLK038651%20MAORI%20HONED%20SPECIAL.jpg",
 					URL:       slabTypes[1],
+					Page:      slabTypes[1],
 				},
 				{
 					Color:     "Black, White",
@@ -441,9 +534,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    127.5,
 					Count:     5,
+					Location:  "Charlotte",
 					Vendor:    1,
+					Key:       "690/38651/358912/Charlotte",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/690-2-358912-BD%20358912%20BLK038651%20MAORI%20HONED%20SPECIAL.jpg",
 					URL:       slabTypes[1],
+					Page:      slabTypes[1],
 				},
 				{
 					Color:     "Black, White",
@@ -454,9 +550,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77,
 					Length:    133,
 					Count:     2,
+					Location:  "Myrtle Beach",
 					Vendor:    1,
+					Key:       "690/22224/81534/Myrtle Beach",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-1-81534-SILVER%20GRAY%203CM%20-%20022224%20-%2081534.JPEG",
 					URL:       slabTypes[1],
+					Page:      slabTypes[1],
 				},
 				{
 					Color:     "Black, White",
@@ -467,9 +566,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77,
 					Length:    133,
 					Count:     1,
+					Location:  "Raleigh",
 					Vendor:    1,
+					Key:       "690/22224/81534/Raleigh",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/536-1-81534-SILVER%20GRAY%203CM%20-%20022224%20-%2081534.JPEG",
 					URL:       slabTypes[1],
+					Page:      slabTypes[1],
 				},
 			},
 		},
@@ -487,9 +589,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77.5,
 					Length:    125,
 					Count:     2,
+					Location:  "Charlotte",
 					Vendor:    1,
+					Key:       "712/9061/14994/Charlotte",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-14994-MAORI%203CM%2014994.jpg",
 					URL:       slabTypes[2],
+					Page:      slabTypes[2],
 				},
 				{
 					Color:     "Black",
@@ -500,9 +605,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77,
 					Length:    125,
 					Count:     2,
+					Location:  "Kernersville",
 					Vendor:    1,
+					Key:       "712/9061/14995/Kernersville",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-14995-MAORI%203CM%2014995.jpg",
 					URL:       slabTypes[2],
+					Page:      slabTypes[2],
 				},
 				{
 					Color:     "Black",
@@ -513,9 +621,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     68.5,
 					Length:    131,
 					Count:     6,
+					Location:  "Lexington",
 					Vendor:    1,
+					Key:       "712/9062/15463/Lexington",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-15463-MAORI%203CM%2015463.jpg",
 					URL:       slabTypes[2],
+					Page:      slabTypes[2],
 				},
 				{
 					Color:     "Black",
@@ -526,9 +637,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     73,
 					Length:    131,
 					Count:     4,
+					Location:  "Raleigh",
 					Vendor:    1,
+					Key:       "712/9062/15460/Raleigh",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-15460-MAORI%203CM%2015460.jpg",
 					URL:       slabTypes[2],
+					Page:      slabTypes[2],
 				},
 				{
 					Color:     "Black",
@@ -539,9 +653,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77,
 					Length:    125.5,
 					Count:     3,
+					Location:  "Raleigh",
 					Vendor:    1,
+					Key:       "712/9061/14996/Raleigh",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-14996-MAORI%203CM%2014996.jpg",
 					URL:       slabTypes[2],
+					Page:      slabTypes[2],
 				},
 				{
 					Color:     "Black",
@@ -552,9 +669,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     77,
 					Length:    125,
 					Count:     1,
+					Location:  "Raleigh",
 					Vendor:    1,
+					Key:       "712/9061/14995/Raleigh",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-14995-MAORI%203CM%2014995.jpg",
 					URL:       slabTypes[2],
+					Page:      slabTypes[2],
 				},
 				{
 					Color:     "Black",
@@ -565,9 +685,12 @@ func TestParseHTML(t *testing.T) {
 					Width:     70.5,
 					Length:    130.5,
 					Count:     1,
+					Location:  "Raleigh",
 					Vendor:    1,
+					Key:       "712/9062/15462/Raleigh",
 					Photo:     "https://www.stonebasyx.com/_siteadmin2015/bundlepics/712-45-15462-MAORI%203CM%2015462.jpg",
 					URL:       slabTypes[2],
+					Page:      slabTypes[2],
 				},
 			},
 		},
@@ -593,3 +716,47 @@ func TestParseHTML(t *testing.T) {
 	}
 	return
 }
+
+// The same lot and bundle can be listed under several warehouses, with
+// different counts, but each slab's Key must be unique.
+func TestKeysUnique(t *testing.T) {
+	for i, input := range []string{"testdata/classic.html", "testdata/honed.html", "testdata/leather.html"} {
+		page, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slabs, err := parseHTML(page, slabTypes[i])
+		if err != nil {
+			t.Fatalf("parsing %s: %s", input, err)
+		}
+		keys := make(map[string]bool)
+		bundles := make(map[string]bool)
+		var repeated bool
+		for _, s := range slabs {
+			if keys[s.Key] {
+				t.Errorf("%s: key %q is not unique", input, s.Key)
+			}
+			keys[s.Key] = true
+			if bundles[s.Lot+"/"+s.Bundle] {
+				repeated = true
+			}
+			bundles[s.Lot+"/"+s.Bundle] = true
+		}
+		if !repeated {
+			t.Errorf("%s: no bundle is in several warehouses", input)
+		}
+	}
+}
+
+// A page without any slabs is an error, rather than every slab being gone.
+func TestParseEmpty(t *testing.T) {
+	tests := map[string]string{
+		"no marker": "<html><body>Under maintenance</body></html>",
+		"no slabs":  "<div>\n<!-- write data here -->\n<strong>Color: <a>Black</a></strong>\n<!-- End main content -->\n</div>",
+	}
+	for name, page := range tests {
+		if slabs, err := parseHTML([]byte(page), slabTypes[0]); err == nil {
+			t.Errorf("%s: parsed %d slabs, want an error", name, len(slabs))
+		}
+	}
+}
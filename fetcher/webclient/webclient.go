@@ -0,0 +1,295 @@
+// Package webclient is the HTTP client shared by all the slab fetchers.  It
+// bounds each request with a timeout, and retries transient failures with
+// exponential backoff and jitter, honoring any Retry-After header which isn't
+// too long to wait.
+package webclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+// Policy describes how long to wait for a request, and how to retry it.
+type Policy struct {
+	Timeout        time.Duration // for each attempt, including reading the body
+	MaxAttempts    int           // including the first, 1 disables retries
+	InitialBackoff time.Duration // the delay before the first retry
+	MaxBackoff     time.Duration // the backoff doubles up to this limit, and a longer Retry-After gives up
+	Jitter         float64       // randomly shorten each delay by up to this fraction
+	MaxPerHost     int           // concurrent requests to any one host, 0 is unlimited
+}
+
+// DefaultPolicy is suitable for polling vendor websites every few minutes.
+var DefaultPolicy = Policy{
+	Timeout:        30 * time.Second,
+	MaxAttempts:    4,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     time.Minute,
+	Jitter:         0.5,
+	MaxPerHost:     2,
+}
+
+// Client sends requests according to its Policy.  It is safe for concurrent
+// use, but the Policy should not be modified while requests are in flight.
+type Client struct {
+	HTTP   *http.Client
+	Policy Policy
+
+	// sleep waits between attempts, it is replaced by tests
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{} // semaphores limiting requests per host
+}
+
+// New returns a Client using the given Policy.
+func New(p Policy) *Client {
+	return &Client{HTTP: &http.Client{}, Policy: p, sleep: Sleep}
+}
+
+// Default is the Client used by all the fetchers.
+var Default = New(DefaultPolicy)
+
+// Get fetches url and returns the body.
+func (c *Client) Get(ctx context.Context, url string) ([]byte, *slabfinder.PageError) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &slabfinder.PageError{URL: url, Phase: slabfinder.PhaseFetch, Err: err}
+	}
+	return c.Do(ctx, req)
+}
+
+// Do sends req, retrying as necessary, and returns the body of the first
+// successful response.  If req has a body, it must have GetBody set so it can
+// be resent, as http.NewRequest does for common readers.  Any response other
+// than 2xx is a failure.
+func (c *Client) Do(ctx context.Context, req *http.Request) ([]byte, *slabfinder.PageError) {
+	attempts := c.Policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	wait := c.sleep
+	if wait == nil {
+		wait = Sleep
+	}
+	var perr *slabfinder.PageError
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := c.backoff(attempt)
+			if ra := retryAfter(perr); ra > delay {
+				if c.Policy.MaxBackoff > 0 && ra > c.Policy.MaxBackoff {
+					// Waiting that long would hold up the whole cycle.
+					return nil, perr
+				}
+				delay = ra
+			}
+			if err := wait(ctx, delay); err != nil {
+				return nil, perr
+			}
+		}
+		var body []byte
+		body, perr = c.attempt(ctx, req)
+		if perr == nil {
+			return body, nil
+		}
+		if !retryable(ctx, perr) {
+			break
+		}
+	}
+	return nil, perr
+}
+
+// Result is the outcome of one request sent by DoAll.
+type Result struct {
+	Body []byte
+	Err  *slabfinder.PageError
+}
+
+// DoAll sends all the requests concurrently, subject to the Policy
+// MaxPerHost, and returns their results in the same order as reqs.
+func (c *Client) DoAll(ctx context.Context, reqs []*http.Request) []Result {
+	results := make([]Result, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *http.Request) {
+			defer wg.Done()
+			results[i].Body, results[i].Err = c.Do(ctx, req)
+		}(i, req)
+	}
+	wg.Wait()
+	return results
+}
+
+// GetAll fetches all the urls concurrently, subject to the Policy
+// MaxPerHost, and returns their results in the same order as urls.
+func (c *Client) GetAll(ctx context.Context, urls []string) []Result {
+	results := make([]Result, len(urls))
+	var reqs []*http.Request
+	var idx []int // the index in results of each of reqs
+	for i, url := range urls {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			results[i].Err = &slabfinder.PageError{URL: url, Phase: slabfinder.PhaseFetch, Err: err}
+			continue
+		}
+		reqs = append(reqs, req)
+		idx = append(idx, i)
+	}
+	for i, r := range c.DoAll(ctx, reqs) {
+		results[idx[i]] = r
+	}
+	return results
+}
+
+// acquire waits for a slot to send a request to host, and returns the
+// function to release it.
+func (c *Client) acquire(ctx context.Context, host string) (func(), error) {
+	if c.Policy.MaxPerHost <= 0 {
+		return func() {}, nil
+	}
+	c.mu.Lock()
+	if c.hosts == nil {
+		c.hosts = make(map[string]chan struct{})
+	}
+	sem, ok := c.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, c.Policy.MaxPerHost)
+		c.hosts[host] = sem
+	}
+	c.mu.Unlock()
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// attempt sends one copy of the request, bounded by the Policy Timeout.
+func (c *Client) attempt(ctx context.Context, req *http.Request) ([]byte, *slabfinder.PageError) {
+	url := req.URL.String()
+	release, err := c.acquire(ctx, req.URL.Host)
+	if err != nil {
+		return nil, &slabfinder.PageError{URL: url, Phase: slabfinder.PhaseFetch, Err: err}
+	}
+	defer release()
+	if c.Policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Policy.Timeout)
+		defer cancel()
+	}
+	r := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, &slabfinder.PageError{URL: url, Phase: slabfinder.PhaseFetch, Err: err}
+		}
+		r.Body = body
+	}
+	resp, err := c.HTTP.Do(r)
+	if err != nil {
+		return nil, &slabfinder.PageError{URL: url, Phase: slabfinder.PhaseFetch, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &slabfinder.PageError{URL: url, StatusCode: resp.StatusCode, Phase: slabfinder.PhaseFetch, Err: &statusError{resp.Status, resp.Header.Get("Retry-After")}}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &slabfinder.PageError{URL: url, StatusCode: resp.StatusCode, Phase: slabfinder.PhaseRead, Err: err}
+	}
+	return body, nil
+}
+
+// backoff returns how long to wait before the given retry attempt (from 1).
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.Policy.InitialBackoff
+	for i := 1; i < attempt && d < c.Policy.MaxBackoff; i++ {
+		d *= 2
+	}
+	if c.Policy.MaxBackoff > 0 && d > c.Policy.MaxBackoff {
+		d = c.Policy.MaxBackoff
+	}
+	if c.Policy.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * c.Policy.Jitter * float64(d))
+	}
+	return d
+}
+
+// retryable reports whether a failed attempt might succeed if repeated.
+func retryable(ctx context.Context, perr *slabfinder.PageError) bool {
+	if ctx.Err() != nil {
+		return false // the caller gave up
+	}
+	switch {
+	case perr.StatusCode == http.StatusTooManyRequests:
+		return true
+	case perr.StatusCode >= 500:
+		return true
+	case perr.StatusCode != 0 && perr.Phase == slabfinder.PhaseFetch:
+		return false // the server understood us, and said no
+	}
+	return true // network errors and timeouts
+}
+
+// statusError describes a response other than 200 OK.
+type statusError struct {
+	status     string
+	retryAfter string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status: %s", e.status)
+}
+
+// retryAfter returns the delay requested by the server in the Retry-After
+// header of a failed response, or 0 if there was none.
+func retryAfter(perr *slabfinder.PageError) time.Duration {
+	var se *statusError
+	if perr == nil || !errors.As(perr, &se) {
+		return 0
+	}
+	return parseRetryAfter(se.retryAfter, time.Now())
+}
+
+// parseRetryAfter understands both forms of the Retry-After header, a number
+// of seconds, or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Sleep waits for d, or until ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
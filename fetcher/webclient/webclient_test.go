@@ -0,0 +1,254 @@
+package webclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+// flakyServer fails the first failures requests with status, then succeeds.
+type flakyServer struct {
+	mu         sync.Mutex
+	failures   int
+	status     int
+	retryAfter string
+	requests   int
+	bodies     []string
+}
+
+func (f *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	b, _ := io.ReadAll(r.Body)
+	f.bodies = append(f.bodies, string(b))
+	if f.requests <= f.failures {
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		w.WriteHeader(f.status)
+		return
+	}
+	w.Write([]byte("slabs"))
+}
+
+// testClient returns a Client which records the delays instead of sleeping.
+func testClient(delays *[]time.Duration) *Client {
+	c := New(Policy{
+		Timeout:        time.Second,
+		MaxAttempts:    4,
+		InitialBackoff: time.Second,
+		MaxBackoff:     3 * time.Second,
+	})
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return ctx.Err()
+	}
+	return c
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		server     *flakyServer
+		wantErr    bool
+		wantStatus int
+		wantReqs   int
+		wantDelays []time.Duration
+	}{
+		{
+			name:       "succeeds after 5xx",
+			server:     &flakyServer{failures: 2, status: http.StatusBadGateway},
+			wantReqs:   3,
+			wantDelays: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:       "gives up after MaxAttempts",
+			server:     &flakyServer{failures: 10, status: http.StatusServiceUnavailable},
+			wantErr:    true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantReqs:   4,
+			wantDelays: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second},
+		},
+		{
+			name:       "honors Retry-After on 429",
+			server:     &flakyServer{failures: 1, status: http.StatusTooManyRequests, retryAfter: "3"},
+			wantReqs:   2,
+			wantDelays: []time.Duration{3 * time.Second},
+		},
+		{
+			name:       "gives up when Retry-After is longer than MaxBackoff",
+			server:     &flakyServer{failures: 1, status: http.StatusTooManyRequests, retryAfter: "86400"},
+			wantErr:    true,
+			wantStatus: http.StatusTooManyRequests,
+			wantReqs:   1,
+		},
+		{
+			name:       "does not retry 404",
+			server:     &flakyServer{failures: 1, status: http.StatusNotFound},
+			wantErr:    true,
+			wantStatus: http.StatusNotFound,
+			wantReqs:   1,
+		},
+	}
+	for _, tc := range tests {
+		ts := httptest.NewServer(tc.server)
+		var delays []time.Duration
+		c := testClient(&delays)
+		body, perr := c.Get(context.Background(), ts.URL)
+		ts.Close()
+		if gotErr := perr != nil; gotErr != tc.wantErr {
+			t.Errorf("%s: got err %v, want error %t", tc.name, perr, tc.wantErr)
+		}
+		if perr != nil && perr.StatusCode != tc.wantStatus {
+			t.Errorf("%s: got status %d, want %d", tc.name, perr.StatusCode, tc.wantStatus)
+		}
+		if !tc.wantErr && string(body) != "slabs" {
+			t.Errorf("%s: got body %q, want %q", tc.name, body, "slabs")
+		}
+		if tc.server.requests != tc.wantReqs {
+			t.Errorf("%s: got %d requests, want %d", tc.name, tc.server.requests, tc.wantReqs)
+		}
+		if len(delays) != len(tc.wantDelays) {
+			t.Errorf("%s: got delays %v, want %v", tc.name, delays, tc.wantDelays)
+			continue
+		}
+		for i := range delays {
+			if delays[i] != tc.wantDelays[i] {
+				t.Errorf("%s: got delays %v, want %v", tc.name, delays, tc.wantDelays)
+				break
+			}
+		}
+	}
+}
+
+func TestRetryResendsBody(t *testing.T) {
+	fs := &flakyServer{failures: 1, status: http.StatusInternalServerError}
+	ts := httptest.NewServer(fs)
+	defer ts.Close()
+	var delays []time.Duration
+	c := testClient(&delays)
+	req, err := http.NewRequest("POST", ts.URL, strings.NewReader("name=Titanium"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, perr := c.Do(context.Background(), req); perr != nil {
+		t.Fatal(perr)
+	}
+	for i, b := range fs.bodies {
+		if b != "name=Titanium" {
+			t.Errorf("request %d had body %q, want %q", i, b, "name=Titanium")
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(unblock)
+
+	var delays []time.Duration
+	c := testClient(&delays)
+	c.Policy.Timeout = 50 * time.Millisecond
+	c.Policy.MaxAttempts = 2
+	start := time.Now()
+	_, perr := c.Get(context.Background(), ts.URL)
+	if perr == nil {
+		t.Fatal("Get of a hung server succeeded")
+	}
+	if perr.Phase != slabfinder.PhaseFetch {
+		t.Errorf("got phase %s, want %s", perr.Phase, slabfinder.PhaseFetch)
+	}
+	if len(delays) != 1 {
+		t.Errorf("timeouts were retried %d times, want 1", len(delays))
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Get took %s, the timeout was not enforced", elapsed)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	fs := &flakyServer{failures: 10, status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(fs)
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := New(Policy{MaxAttempts: 10, InitialBackoff: time.Hour})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if _, perr := c.Get(ctx, ts.URL); perr == nil {
+		t.Fatal("Get succeeded against a failing server")
+	}
+	if fs.requests != 1 {
+		t.Errorf("got %d requests after cancelation, want 1", fs.requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-3":                            0,
+		"Fri, 01 Sep 2023 12:00:30 GMT": 30 * time.Second,
+		"Fri, 01 Sep 2023 11:00:00 GMT": 0,
+		"soon":                          0,
+	}
+	for v, want := range tests {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", v, got, want)
+		}
+	}
+}
+
+func TestMaxPerHost(t *testing.T) {
+	var mu sync.Mutex
+	var running, max int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	c := New(Policy{Timeout: time.Second, MaxAttempts: 1, MaxPerHost: 2})
+	var urls []string
+	for _, p := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		urls = append(urls, ts.URL+p)
+	}
+	results := c.GetAll(context.Background(), urls)
+	for i, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: %s", urls[i], r.Err)
+			continue
+		}
+		if want := strings.TrimPrefix(urls[i], ts.URL); string(r.Body) != want {
+			t.Errorf("result %d has body %q, want %q", i, r.Body, want)
+		}
+	}
+	if max != 2 {
+		t.Errorf("got %d concurrent requests to one host, want 2", max)
+	}
+}
@@ -0,0 +1,43 @@
+package slabfinder
+
+import (
+	"context"
+	"testing"
+)
+
+type fakeFetcher struct {
+	name string
+}
+
+func (f fakeFetcher) Name() string                              { return f.name }
+func (f fakeFetcher) Vendor() Vendor                            { return UnknownVendor }
+func (f fakeFetcher) Fetch(ctx context.Context) ([]Slab, error) { return nil, nil }
+
+func TestRegister(t *testing.T) {
+	Register(fakeFetcher{"zz-test-b"})
+	Register(fakeFetcher{"zz-test-a"})
+
+	if _, ok := LookupFetcher("zz-test-a"); !ok {
+		t.Errorf("LookupFetcher(%q) did not find the registered fetcher", "zz-test-a")
+	}
+	if _, ok := LookupFetcher("zz-test-missing"); ok {
+		t.Errorf("LookupFetcher(%q) found a fetcher that was never registered", "zz-test-missing")
+	}
+
+	var names []string
+	for _, f := range Fetchers() {
+		names = append(names, f.Name())
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Errorf("Fetchers() not sorted by name: %v", names)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a duplicate fetcher did not panic")
+		}
+	}()
+	Register(fakeFetcher{"zz-test-a"})
+}
@@ -0,0 +1,273 @@
+// Package discord sends notifications to a Discord channel via a webhook.
+//
+// Slabs are sent as rich embeds, up to ten to a message.  When Discord's rate
+// limit is reached, the remaining messages wait until it resets, so a big
+// restock is delivered late rather than lost.
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// username is shown as the author of the messages
+const username = "SlabFinder"
+
+const (
+	maxEmbeds   = 10 // in one message
+	maxAttempts = 5  // for each message, not counting rate limited attempts
+	// backoff is the delay before retrying a failed message, doubled for
+	// each further attempt
+	backoff = 2 * time.Second
+)
+
+// colors of the embeds for each type of event
+var colors = map[notify.EventType]int{
+	notify.New:      0x2ecc71,
+	notify.Changed:  0xf1c40f,
+	notify.Gone:     0x95a5a6,
+	notify.Returned: 0x3498db,
+}
+
+// Config is the discord section of the slabwatcher config file.
+type Config = notify.WebhookConfig
+
+// Notifier posts events to a Discord webhook.  It is safe for concurrent use.
+type Notifier struct {
+	HTTP    *http.Client
+	hookURL string
+
+	// now and sleep are the clock, they are replaced by tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu sync.Mutex // one delivery at a time, to respect the rate limit
+	// resume is when the rate limit allows the next request
+	resume time.Time
+}
+
+// New returns a Notifier which posts to the given webhook URL.
+func New(hookURL string) *Notifier {
+	return &Notifier{HTTP: http.DefaultClient, hookURL: hookURL, now: time.Now, sleep: webclient.Sleep}
+}
+
+// message is the payload of a webhook request.
+type message struct {
+	Username string  `json:"username"`
+	Content  string  `json:"content,omitempty"`
+	Embeds   []embed `json:"embeds,omitempty"`
+
+	attempts int // failed attempts to deliver the message
+}
+
+type embed struct {
+	Title       string     `json:"title,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Color       int        `json:"color,omitempty"`
+	Thumbnail   *thumbnail `json:"thumbnail,omitempty"`
+	Fields      []field    `json:"fields,omitempty"`
+}
+
+type thumbnail struct {
+	URL string `json:"url"`
+}
+
+type field struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Notify sends the events, up to ten to a message.
+func (n *Notifier) Notify(ctx context.Context, events []notify.Event) error {
+	var msgs []*message
+	for len(events) > 0 {
+		size := maxEmbeds
+		if len(events) < size {
+			size = len(events)
+		}
+		msg := &message{Username: username}
+		for _, e := range events[:size] {
+			msg.Embeds = append(msg.Embeds, slabEmbed(e))
+		}
+		msgs = append(msgs, msg)
+		events = events[size:]
+	}
+	return n.deliver(ctx, msgs...)
+}
+
+// Alert sends a plain text message.
+func (n *Notifier) Alert(ctx context.Context, text string) error {
+	return n.deliver(ctx, &message{Username: username, Content: text})
+}
+
+// slabEmbed describes the event's slab.
+func slabEmbed(e notify.Event) embed {
+	s := e.Slab
+	em := embed{
+		Title:       fmt.Sprintf("%s: %s", e.Type, s.Color),
+		URL:         s.URL,
+		Description: fmt.Sprintf("%s at %s", e.Rule, s.Vendor),
+		Color:       colors[e.Type],
+		Fields: []field{
+			{Name: "Size", Value: fmt.Sprintf("%v\" × %v\"", s.Length, s.Width), Inline: true},
+			{Name: "Thickness", Value: fmt.Sprintf("%v cm", s.Thickness), Inline: true},
+			{Name: "Finish", Value: s.Finish.String(), Inline: true},
+			{Name: "Lot / Bundle", Value: fmt.Sprintf("%s / %s", s.Lot, s.Bundle), Inline: true},
+			{Name: "Count", Value: strconv.Itoa(s.Count), Inline: true},
+		},
+	}
+	if s.Location != "" {
+		em.Description += ", " + s.Location
+	}
+	if len(e.Changes) > 0 {
+		em.Description += "\n" + e.ChangeSummary()
+	}
+	if s.Photo != "" {
+		em.Thumbnail = &thumbnail{URL: s.Photo}
+	}
+	return em
+}
+
+// deliver sends msgs in order.  Rate limited messages are retried as soon as
+// Discord allows, and other failures with backoff, up to maxAttempts.  The
+// caller is responsible for retrying any messages which were not delivered,
+// eg. from the outbox.
+func (n *Notifier) deliver(ctx context.Context, msgs ...*message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var errs []error
+	queue := msgs
+	for len(queue) > 0 && ctx.Err() == nil {
+		msg := queue[0]
+		if wait := n.resume.Sub(n.now()); wait > 0 {
+			if err := n.sleep(ctx, wait); err != nil {
+				break
+			}
+		}
+		err := n.post(ctx, msg)
+		var rl *rateLimitError
+		switch {
+		case err == nil:
+			queue = queue[1:]
+		case errors.As(err, &rl):
+			// Try the same message again once the limit resets.
+			n.resume = n.now().Add(rl.retryAfter)
+		case isPermanent(err):
+			errs = append(errs, err)
+			queue = queue[1:]
+		default:
+			msg.attempts++
+			if msg.attempts >= maxAttempts {
+				errs = append(errs, err)
+				queue = queue[1:]
+				continue
+			}
+			n.sleep(ctx, backoff<<(msg.attempts-1))
+		}
+	}
+	if len(queue) > 0 {
+		errs = append(errs, fmt.Errorf("%d messages were not sent: %s", len(queue), ctx.Err()))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("discord: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// rateLimitError is a 429 response.
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limited for %s", e.retryAfter)
+}
+
+// statusError is any other unsuccessful response.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.code, http.StatusText(e.code), e.body)
+}
+
+// isPermanent reports whether retrying the request is pointless, because
+// Discord rejected it.
+func isPermanent(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code >= 400 && se.code < 500
+}
+
+// post sends one message, and records when the rate limit allows the next.
+func (n *Notifier) post(ctx context.Context, msg *message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return &statusError{code: http.StatusBadRequest, body: err.Error()}
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.hookURL, bytes.NewReader(body))
+	if err != nil {
+		return &statusError{code: http.StatusBadRequest, body: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	rb, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if d, ok := parseSeconds(resp.Header.Get("X-RateLimit-Reset-After")); ok {
+			n.resume = n.now().Add(d)
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &rateLimitError{retryAfter: retryAfter(resp.Header, rb)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(rb))}
+	}
+	return nil
+}
+
+// retryAfter returns how long a 429 response says to wait, from the
+// retry_after in the body, or else the Retry-After or X-RateLimit-Reset-After
+// headers.
+func retryAfter(h http.Header, body []byte) time.Duration {
+	var rl struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &rl) == nil && rl.RetryAfter > 0 {
+		return time.Duration(rl.RetryAfter * float64(time.Second))
+	}
+	for _, name := range []string{"Retry-After", "X-RateLimit-Reset-After"} {
+		if d, ok := parseSeconds(h.Get(name)); ok {
+			return d
+		}
+	}
+	return time.Second
+}
+
+// parseSeconds parses a number of seconds, which may be fractional.
+func parseSeconds(v string) (time.Duration, bool) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, false
+	}
+	return time.Duration(f * float64(time.Second)), true
+}
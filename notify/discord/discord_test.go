@@ -0,0 +1,207 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// webhookServer records the messages posted to it.  Each response is
+// written by the next of respond, or is 204 No Content once they run out.
+type webhookServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	got     []message
+	respond []func(w http.ResponseWriter)
+}
+
+func newWebhookServer(t *testing.T, respond ...func(w http.ResponseWriter)) *webhookServer {
+	s := &webhookServer{respond: respond}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("decoding message: %s", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.got = append(s.got, msg)
+		if len(s.respond) > 0 {
+			s.respond[0](w)
+			s.respond = s.respond[1:]
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func rateLimited(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprint(w, `{"message": "You are being rate limited.", "retry_after": 1.5, "global": false}`)
+}
+
+func serverError(w http.ResponseWriter) {
+	http.Error(w, "oops", http.StatusInternalServerError)
+}
+
+// testNotifier returns a Notifier with a fake clock, which records how long
+// it sleeps.
+func testNotifier(url string, slept *[]time.Duration) *Notifier {
+	n := New(url)
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+	n.sleep = func(ctx context.Context, d time.Duration) error {
+		*slept = append(*slept, d)
+		now = now.Add(d)
+		return nil
+	}
+	return n
+}
+
+func slabEvents(n int) []notify.Event {
+	var events []notify.Event
+	for i := 0; i < n; i++ {
+		events = append(events, notify.Event{Type: notify.New, Rule: "island", Slab: slabfinder.Slab{
+			Color: "Taj Mahal", Lot: fmt.Sprint(i), Bundle: "B1", Count: 4,
+			Length: 130, Width: 77.5, Thickness: 3, Finish: slabfinder.Leather,
+			Vendor: slabfinder.Cosmos, Location: "Charlotte",
+			URL: fmt.Sprintf("https://example.com/%d", i), Photo: fmt.Sprintf("https://example.com/%d.jpg", i),
+		}})
+	}
+	return events
+}
+
+func TestNotify(t *testing.T) {
+	s := newWebhookServer(t)
+	var slept []time.Duration
+	if err := testNotifier(s.URL, &slept).Notify(context.Background(), slabEvents(23)); err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, msg := range s.got {
+		sizes = append(sizes, len(msg.Embeds))
+	}
+	if diff := cmp.Diff([]int{10, 10, 3}, sizes); diff != "" {
+		t.Errorf("embeds per message:\n%s", diff)
+	}
+	want := embed{
+		Title:       "New: Taj Mahal",
+		URL:         "https://example.com/0",
+		Description: "island at Cosmos, Charlotte",
+		Color:       0x2ecc71,
+		Thumbnail:   &thumbnail{URL: "https://example.com/0.jpg"},
+		Fields: []field{
+			{Name: "Size", Value: `130" × 77.5"`, Inline: true},
+			{Name: "Thickness", Value: "3 cm", Inline: true},
+			{Name: "Finish", Value: "Leather", Inline: true},
+			{Name: "Lot / Bundle", Value: "0 / B1", Inline: true},
+			{Name: "Count", Value: "4", Inline: true},
+		},
+	}
+	if diff := cmp.Diff(want, s.got[0].Embeds[0]); diff != "" {
+		t.Errorf("first embed:\n%s", diff)
+	}
+	if s.got[2].Embeds[2].Title != "New: Taj Mahal" || s.got[2].Embeds[2].URL != "https://example.com/22" {
+		t.Errorf("last embed is %+v", s.got[2].Embeds[2])
+	}
+	if len(slept) != 0 {
+		t.Errorf("slept %v without being rate limited", slept)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newWebhookServer(t, rateLimited, rateLimited)
+	var slept []time.Duration
+	if err := testNotifier(s.URL, &slept).Notify(context.Background(), slabEvents(12)); err != nil {
+		t.Fatal(err)
+	}
+	// The first message is retried twice, then both are delivered in order.
+	var lots []string
+	for _, msg := range s.got {
+		lots = append(lots, msg.Embeds[0].Fields[3].Value)
+	}
+	if diff := cmp.Diff([]string{"0 / B1", "0 / B1", "0 / B1", "10 / B1"}, lots); diff != "" {
+		t.Errorf("first lot of each message:\n%s", diff)
+	}
+	if diff := cmp.Diff([]time.Duration{1500 * time.Millisecond, 1500 * time.Millisecond}, slept); diff != "" {
+		t.Errorf("waits:\n%s", diff)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	exhausted := func(w http.ResponseWriter) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset-After", "2.25")
+		w.WriteHeader(http.StatusNoContent)
+	}
+	s := newWebhookServer(t, exhausted)
+	var slept []time.Duration
+	if err := testNotifier(s.URL, &slept).Notify(context.Background(), slabEvents(11)); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.got) != 2 {
+		t.Errorf("sent %d messages, want 2", len(s.got))
+	}
+	// It waits for the bucket to reset before sending the second message.
+	if diff := cmp.Diff([]time.Duration{2250 * time.Millisecond}, slept); diff != "" {
+		t.Errorf("waits:\n%s", diff)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var respond []func(w http.ResponseWriter)
+	for i := 0; i < maxAttempts; i++ {
+		respond = append(respond, serverError)
+	}
+	s := newWebhookServer(t, respond...)
+	var slept []time.Duration
+	n := testNotifier(s.URL, &slept)
+	ctx := context.Background()
+
+	if err := n.Alert(ctx, "ohm is unreachable"); err == nil {
+		t.Errorf("an undelivered message was not reported")
+	}
+	if len(s.got) != maxAttempts {
+		t.Errorf("made %d attempts, want %d", len(s.got), maxAttempts)
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}
+	if diff := cmp.Diff(want, slept); diff != "" {
+		t.Errorf("backoff:\n%s", diff)
+	}
+
+	// A transient failure is retried.
+	s.got = nil
+	s.respond = []func(w http.ResponseWriter){serverError}
+	if err := n.Notify(ctx, slabEvents(1)); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.got) != 2 {
+		t.Errorf("made %d attempts, want 2", len(s.got))
+	}
+}
+
+func TestRejected(t *testing.T) {
+	s := newWebhookServer(t, func(w http.ResponseWriter) {
+		http.Error(w, `{"message": "Unknown Webhook", "code": 10015}`, http.StatusNotFound)
+	})
+	var slept []time.Duration
+	n := testNotifier(s.URL, &slept)
+	if err := n.Notify(context.Background(), slabEvents(1)); err == nil {
+		t.Errorf("a rejected message was not reported")
+	}
+	if len(s.got) != 1 {
+		t.Errorf("a rejected message was retried %d times", len(s.got)-1)
+	}
+}
@@ -0,0 +1,454 @@
+// Package email sends notifications by SMTP.  Each batch of events is one
+// message, with an HTML table of the slabs and their photos attached inline,
+// and a plain text alternative for mail readers which don't show HTML.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// The ways of securing the connection to the server.
+const (
+	StartTLS = "starttls" // upgrade a plain connection, usually on port 587
+	TLS      = "tls"      // connect with TLS, usually on port 465
+	NoTLS    = "none"     // never encrypt, only for servers on localhost
+)
+
+// Config is the email section of the slabwatcher config file.  Email is only
+// sent if Host is set.
+type Config struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"` // defaults to 587, or 465 if TLS is "tls"
+	// TLS is "starttls" (the default), "tls" or "none"
+	TLS string `yaml:"tls"`
+
+	// Username enables authentication, with Password or the contents of
+	// PasswordFile
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+
+	From string   `yaml:"from"`
+	To   []string `yaml:"to"`
+}
+
+// Enabled reports whether email should be sent.
+func (c Config) Enabled() bool {
+	return c.Host != ""
+}
+
+// Validate checks the Config for mistakes.
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	switch c.TLS {
+	case "", StartTLS, TLS, NoTLS:
+	default:
+		return fmt.Errorf("tls must be %q, %q or %q, not %q", StartTLS, TLS, NoTLS, c.TLS)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", c.Port)
+	}
+	if c.Password != "" && c.PasswordFile != "" {
+		return fmt.Errorf("only one of password and password_file may be set")
+	}
+	if c.From == "" {
+		return fmt.Errorf("from must be set")
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("from: %s", err)
+	}
+	if len(c.To) == 0 {
+		return fmt.Errorf("to must list at least one address")
+	}
+	for _, to := range c.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("to: %q: %s", to, err)
+		}
+	}
+	return nil
+}
+
+// addr returns the host:port of the server.
+func (c Config) addr() string {
+	port := c.Port
+	if port == 0 {
+		port = 587
+		if c.TLS == TLS {
+			port = 465
+		}
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// Notifier sends events by email.
+type Notifier struct {
+	cfg      Config
+	password string
+
+	// Photos fetches the slab photos, by default webclient.Default.  If a
+	// photo can't be fetched, the message is sent without it.
+	Photos *webclient.Client
+	// TLSConfig is used to connect to the server, by default verifying its
+	// certificate for Host.
+	TLSConfig *tls.Config
+}
+
+// New returns a Notifier which sends messages as described by c, reading the
+// password file if there is one.
+func New(c Config) (*Notifier, error) {
+	n := &Notifier{cfg: c, password: c.Password, Photos: webclient.Default}
+	if c.PasswordFile != "" {
+		pb, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading password file: %s", err)
+		}
+		n.password = strings.TrimSpace(string(pb))
+	}
+	return n, nil
+}
+
+// Notify sends one message describing all the events.
+func (n *Notifier) Notify(ctx context.Context, events []notify.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	msg, err := n.message(ctx, events)
+	if err != nil {
+		return fmt.Errorf("email: %s", err)
+	}
+	if err := n.send(ctx, msg); err != nil {
+		return fmt.Errorf("email: %s", err)
+	}
+	return nil
+}
+
+// Alert sends a plain text message.
+func (n *Notifier) Alert(ctx context.Context, message string) error {
+	var buf bytes.Buffer
+	n.writeHeader(&buf, "SlabFinder alert")
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	io.WriteString(qp, message+"\n")
+	qp.Close()
+	if err := n.send(ctx, buf.Bytes()); err != nil {
+		return fmt.Errorf("email: %s", err)
+	}
+	return nil
+}
+
+// subject summarizes the events, eg. "SlabFinder: 2 New slabs for kitchen".
+func subject(events []notify.Event) string {
+	counts := make(map[notify.EventType]int)
+	var order []notify.EventType
+	for _, e := range events {
+		if counts[e.Type] == 0 {
+			order = append(order, e.Type)
+		}
+		counts[e.Type]++
+	}
+	var parts []string
+	for _, t := range order {
+		noun := "slabs"
+		if counts[t] == 1 {
+			noun = "slab"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s %s", counts[t], t, noun))
+	}
+	return fmt.Sprintf("SlabFinder: %s for %s", strings.Join(parts, ", "), events[0].Profile)
+}
+
+func (n *Notifier) writeHeader(w io.Writer, subj string) {
+	fmt.Fprintf(w, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(w, "To: %s\r\n", strings.Join(n.cfg.To, ", "))
+	fmt.Fprintf(w, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subj))
+	fmt.Fprintf(w, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(w, "MIME-Version: 1.0\r\n")
+}
+
+// messageID derives the Message-ID from the events' keys, so a message
+// delivered twice can be recognized as a repeat.  It is empty if the events
+// have no keys.
+func messageID(events []notify.Event) string {
+	h := sha256.New()
+	for _, e := range events {
+		if e.Key == "" {
+			return ""
+		}
+		fmt.Fprintf(h, "%s\n", e.Key)
+	}
+	return fmt.Sprintf("<%x@slabfinder>", h.Sum(nil)[:16])
+}
+
+// row is one slab in the HTML table.
+type row struct {
+	notify.Event
+	CID string // the Content-ID of the photo, if it was attached
+}
+
+// Src returns the URL of the attached photo.  html/template would otherwise
+// reject the cid: scheme as unsafe.
+func (r row) Src() template.URL {
+	return template.URL("cid:" + r.CID)
+}
+
+var htmlTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html><body>
+<table cellpadding="4" style="border-collapse: collapse">
+<tr><th></th><th>Event</th><th>Rule</th><th>Color</th><th>Size</th><th>Thickness</th><th>Finish</th><th>Lot</th><th>Bundle</th><th>Count</th><th>Vendor</th><th>Location</th><th></th></tr>
+{{range .}}<tr style="border-top: 1px solid #ccc">
+<td>{{if .CID}}<img src="{{.Src}}" width="240" alt="{{.Slab.Color}}">{{end}}</td>
+<td>{{.Type}}{{range .Changes}}<br>{{.}}{{end}}</td>
+<td>{{.Rule}}</td>
+<td>{{.Slab.Color}}</td>
+<td>{{.Slab.Length}}" x {{.Slab.Width}}"</td>
+<td>{{.Slab.Thickness}} cm</td>
+<td>{{.Slab.Finish}}</td>
+<td>{{.Slab.Lot}}</td>
+<td>{{.Slab.Bundle}}</td>
+<td>{{.Slab.Count}}</td>
+<td>{{.Slab.Vendor}}</td>
+<td>{{.Slab.Location}}</td>
+<td>{{if .Slab.URL}}<a href="{{.Slab.URL}}">details</a>{{end}}</td>
+</tr>
+{{end}}</table>
+</body></html>
+`))
+
+// message returns the complete message for the events, fetching their photos.
+func (n *Notifier) message(ctx context.Context, events []notify.Event) ([]byte, error) {
+	photos := n.photos(ctx, events)
+	rows := make([]row, len(events))
+	for i, e := range events {
+		rows[i].Event = e
+		if photos[i] != nil {
+			rows[i].CID = fmt.Sprintf("slab%d@slabfinder", i)
+		}
+	}
+
+	// The HTML and photos are a multipart/related part, which is the
+	// second, preferred alternative to the plain text.
+	var related bytes.Buffer
+	rw := multipart.NewWriter(&related)
+	hw, err := rw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(hw)
+	if err := htmlTemplate.Execute(qp, rows); err != nil {
+		return nil, err
+	}
+	qp.Close()
+	for i, r := range rows {
+		if r.CID == "" {
+			continue
+		}
+		pw, err := rw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {photos[i].contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + r.CID + ">"},
+			"Content-Disposition":       {fmt.Sprintf("inline; filename=%q", fmt.Sprintf("slab%d%s", i, photos[i].ext()))},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(pw, photos[i].body)
+	}
+	rw.Close()
+
+	var buf bytes.Buffer
+	n.writeHeader(&buf, subject(events))
+	if id := messageID(events); id != "" {
+		fmt.Fprintf(&buf, "Message-ID: %s\r\n", id)
+	}
+	aw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", aw.Boundary())
+	tw, err := aw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp = quotedprintable.NewWriter(tw)
+	for _, e := range events {
+		fmt.Fprintf(qp, "%s\n", e.String())
+		if e.Slab.URL != "" {
+			fmt.Fprintf(qp, "%s\n", e.Slab.URL)
+		}
+		fmt.Fprintf(qp, "\n")
+	}
+	qp.Close()
+	pw, err := aw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/related; boundary=" + rw.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pw.Write(related.Bytes()); err != nil {
+		return nil, err
+	}
+	aw.Close()
+	return buf.Bytes(), nil
+}
+
+// photo is a fetched Slab.Photo
+type photo struct {
+	contentType string
+	body        []byte
+}
+
+// ext returns the file extension for the photo's type.
+func (p *photo) ext() string {
+	exts, _ := mime.ExtensionsByType(p.contentType)
+	if len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
+
+// photos fetches the photo of each event's slab, with a nil photo for any
+// slab without one, or where it could not be fetched.
+func (n *Notifier) photos(ctx context.Context, events []notify.Event) []*photo {
+	photos := make([]*photo, len(events))
+	var urls []string
+	var idx []int
+	for i, e := range events {
+		if e.Slab.Photo != "" {
+			urls = append(urls, e.Slab.Photo)
+			idx = append(idx, i)
+		}
+	}
+	if len(urls) == 0 || n.Photos == nil {
+		return photos
+	}
+	for j, r := range n.Photos.GetAll(ctx, urls) {
+		if r.Err != nil {
+			continue
+		}
+		ct := http.DetectContentType(r.Body)
+		if !strings.HasPrefix(ct, "image/") {
+			continue
+		}
+		photos[idx[j]] = &photo{contentType: ct, body: r.Body}
+	}
+	return photos
+}
+
+// writeBase64 writes b in base64, in lines of 76 characters as MIME requires.
+func writeBase64(w io.Writer, b []byte) {
+	enc := base64.StdEncoding.EncodeToString(b)
+	for len(enc) > 76 {
+		io.WriteString(w, enc[:76]+"\r\n")
+		enc = enc[76:]
+	}
+	io.WriteString(w, enc+"\r\n")
+}
+
+// envelope returns the bare address from addr, eg. "a@example.com" from
+// "Alice <a@example.com>".  addr was checked by Validate.
+func envelope(addr string) string {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	return a.Address
+}
+
+// send delivers msg to every recipient.
+func (n *Notifier) send(ctx context.Context, msg []byte) error {
+	tlsConfig := n.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: n.cfg.Host}
+	}
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{}
+	if n.cfg.TLS == TLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", n.cfg.addr())
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", n.cfg.addr())
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock the conversation if the context is canceled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if n.cfg.TLS == "" || n.cfg.TLS == StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", n.cfg.addr())
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS: %s", err)
+		}
+	}
+	if n.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.cfg.Username, n.password, n.cfg.Host)); err != nil {
+			return fmt.Errorf("authenticating: %s", err)
+		}
+	}
+	if err := c.Mail(envelope(n.cfg.From)); err != nil {
+		return err
+	}
+	for _, to := range n.cfg.To {
+		if err := c.Rcpt(envelope(to)); err != nil {
+			return fmt.Errorf("recipient %s: %s", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
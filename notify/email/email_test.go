@@ -0,0 +1,294 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// smtpServer is a minimal in-process SMTP server which records the messages
+// it receives.
+type smtpServer struct {
+	l        net.Listener
+	startTLS bool // whether to advertise STARTTLS
+
+	mu       sync.Mutex
+	auth     []string // decoded AUTH PLAIN credentials
+	from     []string
+	rcpt     []string
+	messages [][]byte
+}
+
+func newSMTPServer(t *testing.T, startTLS bool) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{l: l, startTLS: startTLS}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// config returns a Config which sends to the server, without TLS.
+func (s *smtpServer) config() Config {
+	return Config{
+		Host: "127.0.0.1",
+		Port: s.l.Addr().(*net.TCPAddr).Port,
+		TLS:  NoTLS,
+		From: "SlabFinder <slabs@example.com>",
+		To:   []string{"kitchen@example.com", "Bob <bob@example.com>"},
+	}
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		s.mu.Lock()
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			tc.PrintfLine("250-localhost")
+			if s.startTLS {
+				tc.PrintfLine("250-STARTTLS")
+			}
+			tc.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			_, resp, _ := strings.Cut(arg, " ")
+			creds, _ := base64.StdEncoding.DecodeString(resp)
+			s.auth = append(s.auth, string(creds))
+			tc.PrintfLine("235 OK")
+		case "MAIL":
+			s.from = append(s.from, arg)
+			tc.PrintfLine("250 OK")
+		case "RCPT":
+			s.rcpt = append(s.rcpt, arg)
+			tc.PrintfLine("250 OK")
+		case "DATA":
+			tc.PrintfLine("354 go ahead")
+			s.mu.Unlock()
+			msg, err := tc.ReadDotBytes()
+			s.mu.Lock()
+			if err != nil {
+				s.mu.Unlock()
+				return
+			}
+			s.messages = append(s.messages, msg)
+			tc.PrintfLine("250 OK")
+		case "QUIT":
+			tc.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			tc.PrintfLine("250 OK")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// parts returns the content type and decoded body of each leaf part of msg.
+func parts(t *testing.T, r io.Reader, contentType string) map[string][]byte {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string][]byte)
+	mr := multipart.NewReader(r, params["boundary"])
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			return found
+		}
+		if err != nil {
+			t.Fatalf("reading %s: %s", mediaType, err)
+		}
+		ct := p.Header.Get("Content-Type")
+		if strings.HasPrefix(ct, "multipart/") {
+			for k, v := range parts(t, p, ct) {
+				found[k] = v
+			}
+			continue
+		}
+		var body io.Reader = p
+		switch p.Header.Get("Content-Transfer-Encoding") {
+		case "base64":
+			body = base64.NewDecoder(base64.StdEncoding, p)
+		case "quoted-printable":
+			body = quotedprintable.NewReader(p)
+		}
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := ct
+		if cid := p.Header.Get("Content-ID"); cid != "" {
+			key = cid
+		}
+		found[key] = b
+	}
+}
+
+func TestNotify(t *testing.T) {
+	img := pngImage(t)
+	photos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/6656.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(img)
+	}))
+	defer photos.Close()
+	srv := newSMTPServer(t, false)
+	cfg := srv.config()
+	cfg.Username = "slabs"
+	cfg.Password = "hunter2"
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Photos = webclient.New(webclient.Policy{MaxAttempts: 1})
+
+	events := []notify.Event{
+		{Type: notify.New, Profile: "kitchen", Rule: "island", Slab: slabfinder.Slab{
+			Color: "Taj Mahal", Lot: "6656", Bundle: "B1", Length: 130, Width: 77,
+			Thickness: 3, Finish: slabfinder.Leather, Vendor: slabfinder.Cosmos,
+			URL: "https://example.com/6656", Photo: photos.URL + "/6656.png",
+		}},
+		{Type: notify.New, Profile: "kitchen", Rule: "island", Slab: slabfinder.Slab{
+			Color: "Fantasy Brown", Lot: "8907", Length: 131.5, Width: 75,
+			Photo: photos.URL + "/missing.png",
+		}},
+	}
+	if err := n.Notify(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if diff := cmp.Diff([]string{"\x00slabs\x00hunter2"}, srv.auth); diff != "" {
+		t.Errorf("auth:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"FROM:<slabs@example.com>"}, srv.from); diff != "" {
+		t.Errorf("MAIL:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"TO:<kitchen@example.com>", "TO:<bob@example.com>"}, srv.rcpt); diff != "" {
+		t.Errorf("RCPT:\n%s", diff)
+	}
+	if len(srv.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(srv.messages))
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(srv.messages[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := msg.Header.Get("Subject"), "SlabFinder: 2 New slabs for kitchen"; got != want {
+		t.Errorf("Subject %q, want %q", got, want)
+	}
+	found := parts(t, msg.Body, msg.Header.Get("Content-Type"))
+
+	text := string(found["text/plain; charset=utf-8"])
+	for _, want := range []string{events[0].String(), events[1].String(), "https://example.com/6656"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part does not contain %q:\n%s", want, text)
+		}
+	}
+	html := string(found["text/html; charset=utf-8"])
+	for _, want := range []string{`<img src="cid:slab0@slabfinder"`, "Taj Mahal", "Fantasy Brown", "6656", "B1", "Leather", "Cosmos", `href="https://example.com/6656"`, `130" x 77"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML part does not contain %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "cid:slab1") {
+		t.Errorf("HTML part refers to a photo which could not be fetched:\n%s", html)
+	}
+	if !bytes.Equal(found["<slab0@slabfinder>"], img) {
+		t.Errorf("inline photo is %q, want %q", found["<slab0@slabfinder>"], img)
+	}
+}
+
+func TestStartTLSRequired(t *testing.T) {
+	srv := newSMTPServer(t, false)
+	cfg := srv.config()
+	cfg.TLS = StartTLS
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = n.Alert(context.Background(), "stonebasyx has been unreachable")
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("sent to a server without STARTTLS, got error %v", err)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.messages) != 0 {
+		t.Errorf("sent %d messages in the clear", len(srv.messages))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	good := Config{Host: "smtp.example.com", From: "slabs@example.com", To: []string{"me@example.com"}}
+	for _, tc := range []struct {
+		name   string
+		modify func(c *Config)
+		ok     bool
+	}{
+		{"good", func(c *Config) {}, true},
+		{"disabled", func(c *Config) { *c = Config{} }, true},
+		{"bad tls", func(c *Config) { c.TLS = "ssl" }, false},
+		{"no from", func(c *Config) { c.From = "" }, false},
+		{"bad to", func(c *Config) { c.To = []string{"not an address"} }, false},
+		{"no to", func(c *Config) { c.To = nil }, false},
+		{"two passwords", func(c *Config) { c.Password, c.PasswordFile = "a", "b" }, false},
+	} {
+		c := good
+		tc.modify(&c)
+		if err := c.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%s: Validate() = %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package notify delivers news about slabs to people.
+//
+// The watcher produces a batch of Events each cycle, for each profile, and
+// passes them to the profile's Notifier.  Each kind of destination, like
+// Discord, is implemented in its own subpackage.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+// EventType describes what happened to a slab.
+type EventType int
+
+const (
+	UnknownEvent EventType = 0
+	New          EventType = 1 // the slab matched the profile for the first time
+	Changed      EventType = 2 // a slab the profile was notified about changed
+	Gone         EventType = 3 // a slab the profile was notified about sold
+	Returned     EventType = 4 // a Gone slab is back in stock
+)
+
+func (t EventType) String() string {
+	switch t {
+	case New:
+		return "New"
+	case Changed:
+		return "Changed"
+	case Gone:
+		return "Gone"
+	case Returned:
+		return "Returned"
+	}
+	return "UnknownEvent"
+}
+
+// Event is something which happened to a slab that a profile is watching.
+type Event struct {
+	Type    EventType
+	Profile string          // the name of the profile being notified
+	Rule    string          // the name of the rule which matched the slab
+	Slab    slabfinder.Slab // the slab as it is now, or was last seen if Gone
+	// Changes are what changed, for Changed events
+	Changes []slabfinder.Change
+	// Key is the same each time the event is delivered, so receivers can
+	// ignore repeats.  It may be empty.
+	Key string
+}
+
+// String describes the event in one line, for logs and plain text messages.
+func (e Event) String() string {
+	s := fmt.Sprintf("%s slab [%s]: %s", e.Type, e.Rule, e.Slab.String())
+	if len(e.Changes) > 0 {
+		s += fmt.Sprintf(" (%s)", e.ChangeSummary())
+	}
+	return s
+}
+
+// ChangeSummary describes the Changes, eg. "Count 4 → 2, Price $10.00 → $9.00".
+func (e Event) ChangeSummary() string {
+	var changes []string
+	for _, c := range e.Changes {
+		changes = append(changes, c.String())
+	}
+	return strings.Join(changes, ", ")
+}
+
+// Notifier delivers a batch of events somewhere.  Notify should return an
+// error if any of the events may not have been delivered.
+type Notifier interface {
+	Notify(ctx context.Context, events []Event) error
+}
+
+// Alerter delivers messages about problems with the watcher itself.
+type Alerter interface {
+	Alert(ctx context.Context, message string) error
+}
+
+// Multi is a Notifier which sends events to each of its Notifiers.
+type Multi []Notifier
+
+// Notify sends the events to every Notifier, even if some of them fail.
+func (m Multi) Notify(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, events); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MultiAlerter is an Alerter which sends messages to each of its Alerters.
+type MultiAlerter []Alerter
+
+// Alert sends the message to every Alerter, even if some of them fail.
+func (m MultiAlerter) Alert(ctx context.Context, message string) error {
+	var errs []error
+	for _, a := range m {
+		if err := a.Alert(ctx, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Recorder is a Notifier which remembers the events it is sent, for tests.
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+	alerts []string
+}
+
+// Notify records the events.
+func (r *Recorder) Notify(ctx context.Context, events []Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, events...)
+	return nil
+}
+
+// Alert records the message.
+func (r *Recorder) Alert(ctx context.Context, message string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, message)
+	return nil
+}
+
+// Events returns the events recorded since the last call, and forgets them.
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// Alerts returns the alerts recorded since the last call, and forgets them.
+func (r *Recorder) Alerts() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alerts := r.alerts
+	r.alerts = nil
+	return alerts
+}
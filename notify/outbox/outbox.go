@@ -0,0 +1,251 @@
+// Package outbox keeps notifications on disk until they are delivered, so
+// they survive the watcher being restarted, or a destination being down.
+//
+// The watcher adds each cycle's events to the Outbox before it records that
+// they were sent, and a worker delivers them, retrying with backoff, and
+// removes each Entry once it is delivered.  Delivery is at-least-once: an
+// Entry may be delivered again if the watcher stops before removing it, so
+// each Event carries a Key which receivers can use to ignore repeats.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/asjoyner/slabfinder/notify"
+	"github.com/asjoyner/slabfinder/store/statefile"
+)
+
+// Backoff limits for retrying an Entry.
+const (
+	InitialBackoff = time.Minute
+	MaxBackoff     = time.Hour
+)
+
+// Entry is a batch of events for one destination of one profile.
+type Entry struct {
+	ID          string         `json:"id"` // unique in the Outbox
+	Profile     string         `json:"profile"`
+	Destination string         `json:"destination"` // eg. "discord"
+	Events      []notify.Event `json:"events"`
+	Created     time.Time      `json:"created"`
+
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// DeliverFunc delivers one Entry, returning an error if it should be retried.
+type DeliverFunc func(ctx context.Context, e Entry) error
+
+// Outbox is a queue of Entries, saved to a file whenever it changes.  It is
+// safe for concurrent use.
+type Outbox struct {
+	path string
+	now  func() time.Time // replaced by tests
+
+	mu      sync.Mutex
+	entries []*Entry
+	added   chan struct{} // wakes Run when entries are added
+}
+
+// Open loads the Outbox saved at path.  If the file does not exist yet, the
+// Outbox is empty.  Every entry is due when it is opened, since the watcher is
+// often restarted to fix a destination.
+func Open(path string) (*Outbox, error) {
+	o := &Outbox{path: path, now: time.Now, added: make(chan struct{}, 1)}
+	input, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading outbox: %s", err)
+	}
+	if err := json.Unmarshal(input, &o.entries); err != nil {
+		return nil, fmt.Errorf("parsing outbox: %s", err)
+	}
+	for _, e := range o.entries {
+		e.NextAttempt = time.Time{}
+	}
+	return o, nil
+}
+
+// Key returns the dedupe key for an event, which is the same however many
+// times it is delivered, even if it is queued again because the watcher
+// stopped before saving the cycle.  So it only depends on the saved state:
+// lastSeen is when the slab was last seen before the event, which tells one
+// change, disappearance or return of a slab from the next.  It is ignored for
+// New events, which are only sent once for each slab.
+func Key(e notify.Event, lastSeen time.Time) string {
+	if e.Type == notify.New {
+		return fmt.Sprintf("%s/%s/%016x", e.Profile, e.Type, e.Slab.ID())
+	}
+	return fmt.Sprintf("%s/%s/%016x/%d", e.Profile, e.Type, e.Slab.ID(), lastSeen.Unix())
+}
+
+// Add queues the entries, and saves the Outbox before returning.  Entries are
+// due immediately, unless NextAttempt is set.
+func (o *Outbox) Add(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ids := make(map[string]bool)
+	for _, e := range o.entries {
+		ids[e.ID] = true
+	}
+	for i := range entries {
+		e := entries[i]
+		if ids[e.ID] {
+			return fmt.Errorf("outbox already contains %s", e.ID)
+		}
+		if e.Created.IsZero() {
+			e.Created = o.now()
+		}
+		o.entries = append(o.entries, &e)
+	}
+	if err := o.save(); err != nil {
+		o.entries = o.entries[:len(o.entries)-len(entries)]
+		return err
+	}
+	select {
+	case o.added <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns how many entries are waiting to be delivered.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Entries returns a copy of the waiting entries, oldest first.
+func (o *Outbox) Entries() []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var entries []Entry
+	for _, e := range o.entries {
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+// Deliver attempts every entry which is due, in order, removing those which
+// are delivered and scheduling the others to be retried with backoff.  It
+// returns the errors from the failed deliveries.
+func (o *Outbox) Deliver(ctx context.Context, deliver DeliverFunc) error {
+	o.mu.Lock()
+	now := o.now()
+	var due []Entry
+	for _, e := range o.entries {
+		if !e.NextAttempt.After(now) {
+			due = append(due, *e)
+		}
+	}
+	o.mu.Unlock()
+
+	var errs []error
+	results := make(map[string]error)
+	for _, e := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		err := deliver(ctx, e)
+		results[e.ID] = err
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.ID, err))
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var kept []*Entry
+	for _, e := range o.entries {
+		err, attempted := results[e.ID]
+		if attempted && err == nil {
+			continue
+		}
+		if attempted {
+			e.Attempts++
+			e.LastError = err.Error()
+			e.NextAttempt = o.now().Add(backoff(e.Attempts))
+		}
+		kept = append(kept, e)
+	}
+	o.entries = kept
+	if len(results) > 0 {
+		if err := o.save(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run delivers entries as they are added or become due, until ctx is done.
+// Errors are passed to report, which may be nil.
+func (o *Outbox) Run(ctx context.Context, deliver DeliverFunc, report func(error)) {
+	for {
+		if err := o.Deliver(ctx, deliver); err != nil && report != nil {
+			report(err)
+		}
+		wait := MaxBackoff
+		o.mu.Lock()
+		for _, e := range o.entries {
+			if d := e.NextAttempt.Sub(o.now()); d < wait {
+				wait = d
+			}
+		}
+		o.mu.Unlock()
+		if wait < 0 {
+			wait = 0
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-o.added:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+// backoff returns how long to wait after the given number of failed attempts.
+func backoff(attempts int) time.Duration {
+	d := InitialBackoff
+	for i := 1; i < attempts && d < MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > MaxBackoff {
+		d = MaxBackoff
+	}
+	return d
+}
+
+// save writes the entries to a temporary file, and renames it over the
+// Outbox file, so a crash leaves either the old or the new version.
+func (o *Outbox) save() error {
+	entries := o.entries
+	if entries == nil {
+		entries = []*Entry{}
+	}
+	output, err := json.MarshalIndent(entries, "", "	")
+	if err != nil {
+		return fmt.Errorf("writing outbox: %s", err)
+	}
+	if err := statefile.WriteFile(o.path, output); err != nil {
+		return fmt.Errorf("writing outbox: %s", err)
+	}
+	return nil
+}
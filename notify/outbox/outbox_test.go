@@ -0,0 +1,131 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+func TestDeliver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	o, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	o.now = func() time.Time { return now }
+	events := []notify.Event{{Type: notify.New, Profile: "kitchen", Slab: slabfinder.Slab{Lot: "6656"}}}
+	if err := o.Add(
+		Entry{ID: "a", Profile: "kitchen", Destination: "discord", Events: events},
+		Entry{ID: "b", Profile: "kitchen", Destination: "email", Events: events},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Add(Entry{ID: "a"}); err == nil {
+		t.Errorf("added a duplicate ID")
+	}
+
+	// email is down, so only discord is delivered.
+	var delivered []string
+	deliver := func(ctx context.Context, e Entry) error {
+		if e.Destination == "email" {
+			return errors.New("connection refused")
+		}
+		delivered = append(delivered, e.ID)
+		return nil
+	}
+	if err := o.Deliver(context.Background(), deliver); err == nil {
+		t.Errorf("failed delivery was not reported")
+	}
+	if diff := cmp.Diff([]string{"a"}, delivered); diff != "" {
+		t.Errorf("delivered:\n%s", diff)
+	}
+
+	// The failed entry is kept, with when to retry it.
+	entries := o.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("outbox has %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.ID != "b" || e.Attempts != 1 || e.LastError != "connection refused" || !e.NextAttempt.Equal(now.Add(InitialBackoff)) {
+		t.Errorf("failed entry is %+v", e)
+	}
+
+	// It isn't retried until it is due.
+	delivered = nil
+	if err := o.Deliver(context.Background(), deliver); err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 0 {
+		t.Errorf("delivered %v before it was due", delivered)
+	}
+	now = now.Add(InitialBackoff)
+	if err := o.Deliver(context.Background(), deliver); err == nil {
+		t.Errorf("failed delivery was not reported")
+	}
+	if e := o.Entries()[0]; e.Attempts != 2 || !e.NextAttempt.Equal(now.Add(2*InitialBackoff)) {
+		t.Errorf("entry after two failures is %+v", e)
+	}
+
+	// It is saved, and due as soon as the outbox is reopened.
+	o, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = o.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("reopened outbox has %d entries, want 1", len(entries))
+	}
+	if e := entries[0]; e.ID != "b" || e.Attempts != 2 || !e.NextAttempt.IsZero() {
+		t.Errorf("reopened entry is %+v", e)
+	}
+	if diff := cmp.Diff(events, entries[0].Events); diff != "" {
+		t.Errorf("reopened events:\n%s", diff)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	var got []time.Duration
+	for attempts := 1; attempts <= 8; attempts++ {
+		got = append(got, backoff(attempts))
+	}
+	m := time.Minute
+	want := []time.Duration{m, 2 * m, 4 * m, 8 * m, 16 * m, 32 * m, time.Hour, time.Hour}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("backoff:\n%s", diff)
+	}
+}
+
+func TestKey(t *testing.T) {
+	lastSeen := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	e := notify.Event{Type: notify.Gone, Profile: "kitchen", Slab: slabfinder.Slab{Lot: "6656"}}
+	if Key(e, lastSeen) != Key(e, lastSeen) {
+		t.Errorf("Key is not stable")
+	}
+	other := e
+	other.Profile = "vanity"
+	if Key(e, lastSeen) == Key(other, lastSeen) {
+		t.Errorf("Key is the same for two profiles")
+	}
+	if Key(e, lastSeen) == Key(e, lastSeen.Add(time.Hour)) {
+		t.Errorf("Key is the same for two disappearances")
+	}
+	// The slab's Gone time is set in each cycle it is found missing, so it
+	// isn't part of the Key.
+	again := e
+	again.Slab.Gone = lastSeen.Add(time.Hour)
+	if Key(e, lastSeen) != Key(again, lastSeen) {
+		t.Errorf("Key depends on when the slab was found to be gone")
+	}
+	e.Type = notify.New
+	if Key(e, lastSeen) != Key(e, time.Time{}) {
+		t.Errorf("Key of a New event depends on when the slab was last seen")
+	}
+}
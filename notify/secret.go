@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// WebhookConfig is the config file section of a Notifier which posts to a
+// webhook.  The webhook URL is a secret, so it may be kept in a separate file.
+type WebhookConfig struct {
+	Webhook     string `yaml:"webhook"`
+	WebhookFile string `yaml:"webhook_file"`
+}
+
+// Validate checks the WebhookConfig for mistakes.
+func (c WebhookConfig) Validate() error {
+	if c.Webhook != "" && !strings.HasPrefix(c.Webhook, "https://") {
+		return fmt.Errorf("webhook must be an https:// URL")
+	}
+	return nil
+}
+
+// URL returns the webhook URL, reading it from WebhookFile if it is not set
+// directly.
+func (c WebhookConfig) URL() (string, error) {
+	return Secret(c.Webhook, c.WebhookFile)
+}
+
+// Secret returns value if it is set, or else the contents of file, without
+// surrounding space.  It is not an error for the file to be missing, the
+// secret is empty, so the notifier is left unconfigured.
+func Secret(value, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %s", file, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
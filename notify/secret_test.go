@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "webhook")
+	if err := os.WriteFile(file, []byte("https://example.com/hook\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value, file string
+		want        string
+	}{
+		{"https://example.com/direct", file, "https://example.com/direct"},
+		{"", file, "https://example.com/hook"},
+		{"", filepath.Join(dir, "missing"), ""},
+		{"", "", ""},
+	}
+	for _, tc := range tests {
+		got, err := Secret(tc.value, tc.file)
+		if err != nil || got != tc.want {
+			t.Errorf("Secret(%q, %q) = %q, %v, want %q", tc.value, tc.file, got, err, tc.want)
+		}
+	}
+	if _, err := Secret("", dir); err == nil {
+		t.Errorf("Secret of a directory succeeded")
+	}
+}
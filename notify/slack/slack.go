@@ -0,0 +1,201 @@
+// Package slack sends notifications to a Slack channel via an incoming
+// webhook, formatted with Block Kit.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// Slack's limits on the size of a message.
+const (
+	maxBlocks     = 50   // blocks in one message
+	maxTextLength = 3000 // characters in a section's text
+	maxFieldText  = 2000 // characters in each field of a section
+)
+
+// Config is the slack section of the slabwatcher config file.
+type Config = notify.WebhookConfig
+
+// Notifier posts events to a Slack incoming webhook.
+type Notifier struct {
+	HTTP    *http.Client
+	hookURL string
+}
+
+// New returns a Notifier which posts to the given webhook URL.
+func New(hookURL string) *Notifier {
+	return &Notifier{HTTP: http.DefaultClient, hookURL: hookURL}
+}
+
+// message is the payload of an incoming webhook.  Text is shown in
+// notifications, and by clients which can't display the blocks.
+type message struct {
+	Text   string  `json:"text"`
+	Blocks []block `json:"blocks,omitempty"`
+}
+
+type block struct {
+	Type      string    `json:"type"`
+	Text      *text     `json:"text,omitempty"`
+	Fields    []text    `json:"fields,omitempty"`
+	Accessory *image    `json:"accessory,omitempty"`
+	Elements  []element `json:"elements,omitempty"`
+}
+
+type text struct {
+	Type string `json:"type"` // "mrkdwn" or "plain_text"
+	Text string `json:"text"`
+}
+
+// element is a button.
+type element struct {
+	Type string `json:"type"`
+	Text *text  `json:"text,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// image is a section's photo.  Slack rejects the whole message if an image
+// has no alt text.
+type image struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"image_url"`
+	AltText  string `json:"alt_text"`
+}
+
+// Notify posts the events, batched into as few messages as Slack allows.
+func (n *Notifier) Notify(ctx context.Context, events []notify.Event) error {
+	var errs []error
+	msgs := messages(events)
+	for _, msg := range msgs {
+		if err := n.post(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("slack: %d of %d messages failed: %w", len(errs), len(msgs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Alert posts a plain text message.
+func (n *Notifier) Alert(ctx context.Context, msg string) error {
+	if err := n.post(ctx, message{Text: msg}); err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	return nil
+}
+
+// messages renders the events, starting a new message whenever the next slab
+// would exceed the block limit.
+func messages(events []notify.Event) []message {
+	var msgs []message
+	var cur message
+	for _, e := range events {
+		blocks := slabBlocks(e)
+		if len(cur.Blocks)+len(blocks) > maxBlocks {
+			msgs = append(msgs, cur)
+			cur = message{}
+		}
+		cur.Blocks = append(cur.Blocks, blocks...)
+		if cur.Text != "" {
+			cur.Text += "\n"
+		}
+		cur.Text += e.String()
+	}
+	if len(cur.Blocks) > 0 {
+		msgs = append(msgs, cur)
+	}
+	return msgs
+}
+
+// slabBlocks renders one event as a section with the slab's photo and
+// details, followed by a button linking to the vendor's page for it.
+func slabBlocks(e notify.Event) []block {
+	s := e.Slab
+	section := block{
+		Type: "section",
+		Text: &text{Type: "mrkdwn", Text: fmt.Sprintf("*%s slab [%s]:* %s", e.Type, e.Rule, s.Color)},
+	}
+	if len(e.Changes) > 0 {
+		section.Text.Text += "\n" + e.ChangeSummary()
+	}
+	section.Text.Text = truncate(section.Text.Text, maxTextLength)
+	for _, f := range [][2]string{
+		{"Size", fmt.Sprintf("%v\" x %v\"", s.Length, s.Width)},
+		{"Thickness", fmt.Sprintf("%v cm", s.Thickness)},
+		{"Finish", s.Finish.String()},
+		{"Lot / Bundle", fmt.Sprintf("%s / %s", s.Lot, s.Bundle)},
+		{"Vendor", s.Vendor.String()},
+		{"Location", s.Location},
+	} {
+		if f[1] == "" || f[1] == " / " {
+			continue
+		}
+		section.Fields = append(section.Fields, text{Type: "mrkdwn", Text: truncate(fmt.Sprintf("*%s*\n%s", f[0], f[1]), maxFieldText)})
+	}
+	if s.Photo != "" {
+		section.Accessory = &image{Type: "image", ImageURL: s.Photo, AltText: altText(s)}
+	}
+	blocks := []block{section}
+	if s.URL != "" {
+		blocks = append(blocks, block{
+			Type: "actions",
+			Elements: []element{{
+				Type: "button",
+				Text: &text{Type: "plain_text", Text: "View slab"},
+				URL:  s.URL,
+			}},
+		})
+	}
+	return blocks
+}
+
+// altText describes the slab's photo, even if the vendor didn't name its
+// color, as Cosmos doesn't.
+func altText(s slabfinder.Slab) string {
+	if s.Color != "" {
+		return s.Color
+	}
+	return "slab photo"
+}
+
+// truncate shortens s to at most max characters.
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
+
+func (n *Notifier) post(ctx context.Context, msg message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.hookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		rb, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(rb)))
+	}
+	return nil
+}
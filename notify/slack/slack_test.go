@@ -0,0 +1,127 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// slackServer records the messages posted to it.
+func slackServer(t *testing.T, got *[]message) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type %q, want application/json", ct)
+		}
+		var msg message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("decoding message: %s", err)
+		}
+		*got = append(*got, msg)
+		fmt.Fprint(w, "ok")
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestNotify(t *testing.T) {
+	var got []message
+	ts := slackServer(t, &got)
+	e := notify.Event{Type: notify.New, Profile: "kitchen", Rule: "island", Slab: slabfinder.Slab{
+		Color: "Taj Mahal", Lot: "6656", Bundle: "B1", Length: 130, Width: 77.5,
+		Thickness: 3, Finish: slabfinder.Leather, Vendor: slabfinder.Cosmos,
+		URL: "https://example.com/6656", Photo: "https://example.com/6656.jpg",
+	}}
+	if err := New(ts.URL).Notify(context.Background(), []notify.Event{e}); err != nil {
+		t.Fatal(err)
+	}
+	want := []message{{
+		Text: e.String(),
+		Blocks: []block{
+			{
+				Type: "section",
+				Text: &text{Type: "mrkdwn", Text: "*New slab [island]:* Taj Mahal"},
+				Fields: []text{
+					{Type: "mrkdwn", Text: "*Size*\n130\" x 77.5\""},
+					{Type: "mrkdwn", Text: "*Thickness*\n3 cm"},
+					{Type: "mrkdwn", Text: "*Finish*\nLeather"},
+					{Type: "mrkdwn", Text: "*Lot / Bundle*\n6656 / B1"},
+					{Type: "mrkdwn", Text: "*Vendor*\nCosmos"},
+				},
+				Accessory: &image{Type: "image", ImageURL: "https://example.com/6656.jpg", AltText: "Taj Mahal"},
+			},
+			{
+				Type:     "actions",
+				Elements: []element{{Type: "button", Text: &text{Type: "plain_text", Text: "View slab"}, URL: "https://example.com/6656"}},
+			},
+		},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("posted messages:\n%s", diff)
+	}
+}
+
+func TestNotifyNoColor(t *testing.T) {
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+	// Cosmos doesn't name the color of its slabs.
+	e := notify.Event{Type: notify.New, Slab: slabfinder.Slab{
+		Lot: "6656", Vendor: slabfinder.Cosmos,
+		URL: "https://example.com/6656", Photo: "https://example.com/6656.jpg",
+	}}
+	if err := New(ts.URL).Notify(context.Background(), []notify.Event{e}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"alt_text":"slab photo"`) {
+		t.Errorf("image without alt text: %s", body)
+	}
+	if n := strings.Count(string(body), "alt_text"); n != 1 {
+		t.Errorf("%d alt_text fields, want only the image's: %s", n, body)
+	}
+}
+
+func TestNotifyBatches(t *testing.T) {
+	var got []message
+	ts := slackServer(t, &got)
+	var events []notify.Event
+	for i := 0; i < 30; i++ {
+		events = append(events, notify.Event{Type: notify.New, Slab: slabfinder.Slab{
+			Lot: fmt.Sprint(i), URL: fmt.Sprintf("https://example.com/%d", i),
+		}})
+	}
+	if err := New(ts.URL).Notify(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	var counts []int
+	for _, msg := range got {
+		counts = append(counts, len(msg.Blocks))
+	}
+	// Each slab is a section and a button, so 25 fit in a message.
+	if diff := cmp.Diff([]int{50, 10}, counts); diff != "" {
+		t.Errorf("blocks per message:\n%s", diff)
+	}
+}
+
+func TestNotifyError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_blocks", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	err := New(ts.URL).Notify(context.Background(), []notify.Event{{Type: notify.New}})
+	if err == nil {
+		t.Errorf("a rejected message was not reported")
+	}
+}
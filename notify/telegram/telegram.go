@@ -0,0 +1,305 @@
+// Package telegram sends notifications to a Telegram chat through a bot, as
+// photos of the slabs with their details in the caption.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// DefaultBaseURL is the Telegram Bot API.
+const DefaultBaseURL = "https://api.telegram.org"
+
+// Telegram's limits, and how persistently to wait out flood control.
+const (
+	maxCaption    = 1024 // characters in a photo caption
+	maxMediaGroup = 10   // photos in one album
+	minMediaGroup = 3    // fewer slabs than this are sent as separate photos
+	maxAttempts   = 4    // for each call, when told to retry after a delay
+)
+
+// Config is the telegram section of the slabwatcher config file.  The bot
+// token is a secret, so it may be kept in a separate file.
+type Config struct {
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+	// ChatID is the numeric ID of the chat, or @username of a channel
+	ChatID string `yaml:"chat_id"`
+	// BaseURL defaults to DefaultBaseURL
+	BaseURL string `yaml:"base_url"`
+}
+
+// Validate checks the Config for mistakes.
+func (c Config) Validate() error {
+	if (c.Token != "" || c.TokenFile != "") && c.ChatID == "" {
+		return fmt.Errorf("chat_id must be set")
+	}
+	if c.Token != "" && c.TokenFile != "" {
+		return fmt.Errorf("only one of token and token_file may be set")
+	}
+	if c.BaseURL != "" && !strings.HasPrefix(c.BaseURL, "https://") && !strings.HasPrefix(c.BaseURL, "http://") {
+		return fmt.Errorf("base_url must be an http:// or https:// URL")
+	}
+	return nil
+}
+
+// BotToken returns the token, reading it from TokenFile if it is not set
+// directly.  It is not an error for the file to be missing, the token is
+// empty.
+func (c Config) BotToken() (string, error) {
+	return notify.Secret(c.Token, c.TokenFile)
+}
+
+// Notifier sends events to a Telegram chat.
+type Notifier struct {
+	HTTP    *http.Client
+	baseURL string
+	token   string
+	chatID  string
+
+	// sleep waits out flood control, it is replaced by tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a Notifier which sends to the configured chat with token.
+func New(c Config, token string) *Notifier {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	return &Notifier{
+		HTTP:    http.DefaultClient,
+		baseURL: strings.TrimSuffix(base, "/"),
+		token:   token,
+		chatID:  c.ChatID,
+		sleep:   webclient.Sleep,
+	}
+}
+
+// inputMediaPhoto is one photo in a sendMediaGroup album.
+type inputMediaPhoto struct {
+	Type      string `json:"type"`
+	Media     string `json:"media"`
+	Caption   string `json:"caption,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// Notify sends each slab as a photo with a caption.  Three or more slabs with
+// photos are grouped into albums.  Slabs without a photo are sent as text.
+func (n *Notifier) Notify(ctx context.Context, events []notify.Event) error {
+	var errs []error
+	var photos []notify.Event
+	for _, e := range events {
+		if e.Slab.Photo == "" {
+			if err := n.sendMessage(ctx, caption(e)); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		photos = append(photos, e)
+	}
+	if len(photos) < minMediaGroup {
+		for _, e := range photos {
+			if err := n.sendPhoto(ctx, e); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	} else {
+		for len(photos) > 0 {
+			size := maxMediaGroup
+			if len(photos) < size {
+				size = len(photos)
+			}
+			// An album needs at least two photos, so don't leave one behind.
+			if len(photos)-size == 1 {
+				size--
+			}
+			if err := n.sendMediaGroup(ctx, photos[:size]); err != nil {
+				errs = append(errs, err)
+			}
+			photos = photos[size:]
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("telegram: %d messages failed: %w", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Alert sends a plain text message.
+func (n *Notifier) Alert(ctx context.Context, message string) error {
+	if err := n.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id": n.chatID,
+		"text":    message,
+	}); err != nil {
+		return fmt.Errorf("telegram: %w", err)
+	}
+	return nil
+}
+
+func (n *Notifier) sendMessage(ctx context.Context, text string) error {
+	return n.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":    n.chatID,
+		"text":       text,
+		"parse_mode": "HTML",
+	})
+}
+
+func (n *Notifier) sendPhoto(ctx context.Context, e notify.Event) error {
+	return n.call(ctx, "sendPhoto", map[string]interface{}{
+		"chat_id":    n.chatID,
+		"photo":      e.Slab.Photo,
+		"caption":    caption(e),
+		"parse_mode": "HTML",
+	})
+}
+
+func (n *Notifier) sendMediaGroup(ctx context.Context, events []notify.Event) error {
+	var media []inputMediaPhoto
+	for _, e := range events {
+		media = append(media, inputMediaPhoto{Type: "photo", Media: e.Slab.Photo, Caption: caption(e), ParseMode: "HTML"})
+	}
+	return n.call(ctx, "sendMediaGroup", map[string]interface{}{
+		"chat_id": n.chatID,
+		"media":   media,
+	})
+}
+
+// caption describes the event's slab in Telegram's HTML subset, in at most
+// maxCaption characters.
+func caption(e notify.Event) string {
+	s := e.Slab
+	var b strings.Builder
+	fmt.Fprintf(&b, ": %s\n", s.Color)
+	if len(e.Changes) > 0 {
+		fmt.Fprintf(&b, "%s\n", e.ChangeSummary())
+	}
+	fmt.Fprintf(&b, "%v\" x %v\", %v cm %s\n", s.Length, s.Width, s.Thickness, s.Finish)
+	fmt.Fprintf(&b, "Lot %s", s.Lot)
+	if s.Bundle != "" {
+		fmt.Fprintf(&b, " / Bundle %s", s.Bundle)
+	}
+	fmt.Fprintf(&b, "\n%s", s.Vendor)
+	if s.Location != "" {
+		fmt.Fprintf(&b, ", %s", s.Location)
+	}
+	// The text is cut before it is marked up, so the tags stay balanced.
+	budget := maxCaption - len("<b></b>")
+	title := truncateHTML(fmt.Sprintf("%s slab [%s]", e.Type, e.Rule), budget)
+	budget -= utf8.RuneCountInString(title)
+	c := "<b>" + title + "</b>" + truncateHTML(b.String(), budget)
+	if s.URL != "" {
+		// Drop the link rather than cut it in half.
+		link := fmt.Sprintf("\n<a href=\"%s\">View slab</a>", html.EscapeString(s.URL))
+		if utf8.RuneCountInString(c)+utf8.RuneCountInString(link) <= maxCaption {
+			c += link
+		}
+	}
+	return c
+}
+
+// escape escapes the characters Telegram requires in HTML text.
+var escape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+// truncateHTML escapes s, shortened so that it is at most max characters,
+// without cutting an escaped character in half.
+func truncateHTML(s string, max int) string {
+	if esc := escape(s); utf8.RuneCountInString(esc) <= max {
+		return esc
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		esc := escape(string(r))
+		m := utf8.RuneCountInString(esc)
+		if n+m+1 > max { // leave room for the ellipsis
+			break
+		}
+		b.WriteString(esc)
+		n += m
+	}
+	if max > 0 {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// response is the envelope of every Bot API response.
+type response struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// call invokes a Bot API method, waiting and retrying when told to by flood
+// control.
+func (n *Notifier) call(ctx context.Context, method string, params interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/%s", n.baseURL, n.token, method)
+	for attempt := 1; ; attempt++ {
+		r, err := n.post(ctx, endpoint, body)
+		if err != nil {
+			return fmt.Errorf("%s: %s", method, err)
+		}
+		if r.OK {
+			return nil
+		}
+		if r.ErrorCode != http.StatusTooManyRequests || attempt >= maxAttempts {
+			return fmt.Errorf("%s: %d %s", method, r.ErrorCode, r.Description)
+		}
+		wait := time.Duration(r.Parameters.RetryAfter) * time.Second
+		if wait <= 0 {
+			wait = time.Second
+		}
+		if err := n.sleep(ctx, wait); err != nil {
+			return fmt.Errorf("%s: %s", method, err)
+		}
+	}
+}
+
+// post sends one request, and decodes the response.  The URL contains the
+// token, so it is left out of errors.
+func (n *Notifier) post(ctx context.Context, endpoint string, body []byte) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.New("invalid request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.HTTP.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	rb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var r response
+	if err := json.Unmarshal(rb, &r); err != nil {
+		return nil, fmt.Errorf("%s: parsing response: %s", resp.Status, err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,207 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// call is a Bot API call received by the stand-in server.
+type call struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// botServer is a stand-in for the Bot API.  It responds to the first
+// floodWaits calls with 429 and a retry_after.
+func botServer(t *testing.T, floodWaits int) (*httptest.Server, *[]call) {
+	var calls []call
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := strings.TrimPrefix(r.URL.Path, "/botTOKEN/")
+		if method == r.URL.Path {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"ok":false,"error_code":404,"description":"Not Found"}`)
+			return
+		}
+		var params map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("decoding %s: %s", method, err)
+		}
+		calls = append(calls, call{method, params})
+		if len(calls) <= floodWaits {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{}}`)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &calls
+}
+
+// testNotifier returns a Notifier for the server which records its sleeps
+// instead of sleeping.
+func testNotifier(ts *httptest.Server, slept *[]time.Duration) *Notifier {
+	n := New(Config{ChatID: "@slabs", BaseURL: ts.URL + "/"}, "TOKEN")
+	n.sleep = func(ctx context.Context, d time.Duration) error {
+		*slept = append(*slept, d)
+		return nil
+	}
+	return n
+}
+
+func slabEvents(n int) []notify.Event {
+	var events []notify.Event
+	for i := 0; i < n; i++ {
+		events = append(events, notify.Event{Type: notify.New, Rule: "island", Slab: slabfinder.Slab{
+			Color: "Taj Mahal", Lot: fmt.Sprint(i), Length: 130, Width: 77, Thickness: 3,
+			Finish: slabfinder.Leather, Vendor: slabfinder.Cosmos,
+			Photo: fmt.Sprintf("https://example.com/%d.jpg", i),
+		}})
+	}
+	return events
+}
+
+func TestSendPhoto(t *testing.T) {
+	ts, calls := botServer(t, 0)
+	var slept []time.Duration
+	events := slabEvents(1)
+	events[0].Slab.Bundle = "B<1>"
+	events[0].Slab.URL = "https://example.com/0"
+	if err := testNotifier(ts, &slept).Notify(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	want := []call{{"sendPhoto", map[string]interface{}{
+		"chat_id":    "@slabs",
+		"photo":      "https://example.com/0.jpg",
+		"caption":    "<b>New slab [island]</b>: Taj Mahal\n130\" x 77\", 3 cm Leather\nLot 0 / Bundle B&lt;1&gt;\nCosmos\n<a href=\"https://example.com/0\">View slab</a>",
+		"parse_mode": "HTML",
+	}}}
+	if diff := cmp.Diff(want, *calls); diff != "" {
+		t.Errorf("calls:\n%s", diff)
+	}
+}
+
+func TestCaptionTruncated(t *testing.T) {
+	long := strings.Repeat("<é>", maxCaption)
+	for _, tc := range []struct {
+		name   string
+		rule   string
+		lot    string
+		prefix string
+		suffix string
+	}{
+		{name: "long lot", rule: "island", lot: long, prefix: "<b>New slab [island]</b>: Taj Mahal\n130\" x 77\", 3 cm Leather\nLot &lt;é&gt;", suffix: "…"},
+		{name: "long rule", rule: long, lot: "0", prefix: "<b>New slab [&lt;é&gt;", suffix: "…</b>:…"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := slabEvents(1)[0]
+			e.Rule = tc.rule
+			e.Slab.Lot = tc.lot
+			e.Slab.URL = "https://example.com/0"
+			c := caption(e)
+			if n := utf8.RuneCountInString(c); n > maxCaption || n < maxCaption-len("&lt;") {
+				t.Errorf("caption is %d characters, want %d", n, maxCaption)
+			}
+			if !strings.HasPrefix(c, tc.prefix) {
+				t.Errorf("caption starts %q, want %q", c[:len(tc.prefix)], tc.prefix)
+			}
+			if !strings.HasSuffix(c, tc.suffix) {
+				t.Errorf("caption ends %q, want %q", c[len(c)-10:], tc.suffix)
+			}
+			if strings.Count(c, "<b>") != 1 || strings.Count(c, "</b>") != 1 || strings.Contains(c, "<a ") {
+				t.Errorf("caption has unbalanced tags or a link: %q", c)
+			}
+			if i := strings.LastIndex(c, "&"); i >= 0 && !strings.Contains(c[i:], ";") {
+				t.Errorf("caption cuts an entity in half: %q", c[i:])
+			}
+		})
+	}
+}
+
+func TestSendMediaGroup(t *testing.T) {
+	ts, calls := botServer(t, 0)
+	var slept []time.Duration
+	events := slabEvents(12)
+	events = append(events, notify.Event{Type: notify.New, Slab: slabfinder.Slab{Lot: "nophoto"}})
+	if err := testNotifier(ts, &slept).Notify(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	// The slab without a photo is sent as text, and the other 12 as albums
+	// of 10 and 2.
+	var got []string
+	for _, c := range *calls {
+		s := c.Method
+		if media, ok := c.Params["media"].([]interface{}); ok {
+			s += fmt.Sprintf(" %d", len(media))
+		}
+		got = append(got, s)
+	}
+	if diff := cmp.Diff([]string{"sendMessage", "sendMediaGroup 10", "sendMediaGroup 2"}, got); diff != "" {
+		t.Errorf("calls:\n%s", diff)
+	}
+	first := (*calls)[1].Params["media"].([]interface{})[0].(map[string]interface{})
+	if first["type"] != "photo" || first["media"] != "https://example.com/0.jpg" || !strings.Contains(first["caption"].(string), "Lot 0") {
+		t.Errorf("first photo in the album is %v", first)
+	}
+}
+
+func TestAlbumRemainder(t *testing.T) {
+	ts, calls := botServer(t, 0)
+	var slept []time.Duration
+	if err := testNotifier(ts, &slept).Notify(context.Background(), slabEvents(11)); err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, c := range *calls {
+		sizes = append(sizes, len(c.Params["media"].([]interface{})))
+	}
+	// An album can't have one photo, so 11 are sent as 9 and 2.
+	if diff := cmp.Diff([]int{9, 2}, sizes); diff != "" {
+		t.Errorf("album sizes:\n%s", diff)
+	}
+}
+
+func TestFloodWait(t *testing.T) {
+	ts, calls := botServer(t, 2)
+	var slept []time.Duration
+	if err := testNotifier(ts, &slept).Alert(context.Background(), "ohm is unreachable"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 3 {
+		t.Errorf("got %d calls, want 3", len(*calls))
+	}
+	if diff := cmp.Diff([]time.Duration{7 * time.Second, 7 * time.Second}, slept); diff != "" {
+		t.Errorf("waits:\n%s", diff)
+	}
+
+	// It gives up eventually, and reports the error.
+	ts, _ = botServer(t, maxAttempts)
+	slept = nil
+	err := testNotifier(ts, &slept).Alert(context.Background(), "ohm is unreachable")
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("got error %v, want a 429", err)
+	}
+}
+
+func TestErrorHidesToken(t *testing.T) {
+	n := New(Config{ChatID: "1", BaseURL: "http://127.0.0.1:1"}, "SECRET")
+	err := n.Alert(context.Background(), "hello")
+	if err == nil {
+		t.Fatal("no error from an unreachable server")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("error contains the token: %s", err)
+	}
+}
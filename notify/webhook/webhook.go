@@ -0,0 +1,297 @@
+// Package webhook sends each event to an HTTP endpoint, like ntfy, Home
+// Assistant or n8n, in a format described by templates.
+//
+// The URL, method, headers and body are text/templates, executed with a Data
+// for each event.  For example, to publish to an ntfy topic:
+//
+//	webhooks:
+//	  - url: https://ntfy.sh/my-slabs
+//	    headers:
+//	      Title: "{{.Type}} {{.Slab.Color}} slab"
+//	      Click: "{{.Slab.URL}}"
+//	      Attach: "{{.Slab.Photo}}"
+//	    body: '{{.Slab.Length}}" x {{.Slab.Width}}", lot {{.Slab.Lot}} at {{.Slab.Vendor}}'
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/fetcher/webclient"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+// DefaultBody is the body template if none is configured, the Data as JSON.
+const DefaultBody = "{{json .}}"
+
+// DefaultSignatureHeader carries the HMAC-SHA256 of the body, if there is a
+// Secret.
+const DefaultSignatureHeader = "X-Slabfinder-Signature"
+
+// Config is one entry in the webhooks section of the slabwatcher config file.
+type Config struct {
+	URL     string            `yaml:"url"`     // template
+	Method  string            `yaml:"method"`  // template, defaults to POST
+	Headers map[string]string `yaml:"headers"` // values are templates
+	Body    string            `yaml:"body"`    // template, defaults to DefaultBody
+
+	// Secret, or the contents of SecretFile, signs the body.  The signature
+	// is sent in SignatureHeader as "sha256=" and the hex HMAC-SHA256.
+	Secret          string `yaml:"secret"`
+	SecretFile      string `yaml:"secret_file"`
+	SignatureHeader string `yaml:"signature_header"`
+
+	// Attempts is how many times to try each request, with Backoff before
+	// the first retry, doubling for each retry after that.
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+	Timeout  time.Duration `yaml:"timeout"`
+
+	// DryRun prints each request instead of sending it.
+	DryRun bool `yaml:"dry_run"`
+}
+
+// Data is what the templates are executed with, for each event.
+type Data struct {
+	Type    string          `json:"type"` // eg. "New"
+	Profile string          `json:"profile"`
+	Rule    string          `json:"rule"`
+	Message string          `json:"message"` // a one line description of the event
+	Slab    slabfinder.Slab `json:"slab"`
+	Key     string          `json:"key"` // the dedupe key of the event
+}
+
+var funcs = template.FuncMap{
+	// json encodes a value, eg. {{json .Slab.Color}} for a quoted string
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// templates are the parsed templates of a Config.
+type templates struct {
+	url, method, body *template.Template
+	headers           map[string]*template.Template
+}
+
+func (c Config) parse() (*templates, error) {
+	t := &templates{headers: make(map[string]*template.Template)}
+	method, body := c.Method, c.Body
+	if method == "" {
+		method = http.MethodPost
+	}
+	if body == "" {
+		body = DefaultBody
+	}
+	var err error
+	if t.url, err = template.New("url").Funcs(funcs).Parse(c.URL); err != nil {
+		return nil, err
+	}
+	if t.method, err = template.New("method").Funcs(funcs).Parse(method); err != nil {
+		return nil, err
+	}
+	if t.body, err = template.New("body").Funcs(funcs).Parse(body); err != nil {
+		return nil, err
+	}
+	for name, v := range c.Headers {
+		if t.headers[name], err = template.New(name).Funcs(funcs).Parse(v); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Validate checks the Config for mistakes, including in the templates.
+func (c Config) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("url must be set")
+	}
+	if c.Secret != "" && c.SecretFile != "" {
+		return fmt.Errorf("only one of secret and secret_file may be set")
+	}
+	if c.Attempts < 0 {
+		return fmt.Errorf("attempts must not be negative, not %d", c.Attempts)
+	}
+	if c.Backoff < 0 {
+		return fmt.Errorf("backoff must not be negative, not %s", c.Backoff)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, not %s", c.Timeout)
+	}
+	if _, err := c.parse(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Notifier sends a request for each event.  Events with a Key send it in the
+// Idempotency-Key header, unless a header template replaces it.
+type Notifier struct {
+	cfg    Config
+	tmpl   *templates
+	secret []byte
+	client *webclient.Client
+
+	// DryRun receives the requests instead of sending them, if cfg.DryRun is
+	// set.  It defaults to os.Stdout.
+	DryRun io.Writer
+}
+
+// New returns a Notifier for the Config, reading the secret file if there is
+// one.
+func New(c Config) (*Notifier, error) {
+	tmpl, err := c.parse()
+	if err != nil {
+		return nil, err
+	}
+	p := webclient.Policy{
+		Timeout:        c.Timeout,
+		MaxAttempts:    c.Attempts,
+		InitialBackoff: c.Backoff,
+		MaxBackoff:     time.Minute,
+		Jitter:         0.5,
+	}
+	if p.Timeout == 0 {
+		p.Timeout = 30 * time.Second
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = 2 * time.Second
+	}
+	n := &Notifier{cfg: c, tmpl: tmpl, client: webclient.New(p), DryRun: os.Stdout}
+	n.secret = []byte(c.Secret)
+	if c.SecretFile != "" {
+		sb, err := os.ReadFile(c.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading secret file: %s", err)
+		}
+		n.secret = bytes.TrimSpace(sb)
+	}
+	return n, nil
+}
+
+// Notify sends a request for each event.
+func (n *Notifier) Notify(ctx context.Context, events []notify.Event) error {
+	var errs []error
+	for _, e := range events {
+		req, err := n.request(ctx, e)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if n.cfg.DryRun {
+			if err := dump(n.DryRun, req); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if _, perr := n.client.Do(ctx, req); perr != nil {
+			errs = append(errs, perr)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("webhook: %d of %d requests failed: %w", len(errs), len(events), errors.Join(errs...))
+	}
+	return nil
+}
+
+// request renders the templates for the event.
+func (n *Notifier) request(ctx context.Context, e notify.Event) (*http.Request, error) {
+	data := Data{
+		Type:    e.Type.String(),
+		Profile: e.Profile,
+		Rule:    e.Rule,
+		Message: e.String(),
+		Slab:    e.Slab,
+		Key:     e.Key,
+	}
+	url, err := execute(n.tmpl.url, data)
+	if err != nil {
+		return nil, err
+	}
+	method, err := execute(n.tmpl.method, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := execute(n.tmpl.body, data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(strings.TrimSpace(method)), strings.TrimSpace(url), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if e.Key != "" {
+		req.Header.Set("Idempotency-Key", e.Key)
+	}
+	for name, t := range n.tmpl.headers {
+		v, err := execute(t, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, v)
+	}
+	if len(n.secret) > 0 {
+		header := n.cfg.SignatureHeader
+		if header == "" {
+			header = DefaultSignatureHeader
+		}
+		req.Header.Set(header, "sha256="+Sign(n.secret, []byte(body)))
+	}
+	return req, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body, for receivers to check.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func execute(t *template.Template, data Data) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// dump writes the request roughly as it would be sent.
+func dump(w io.Writer, req *http.Request) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\n", req.Method, req.URL)
+	var names []string
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\n", name, req.Header.Get(name))
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(&buf)
+	io.Copy(&buf, body)
+	fmt.Fprintf(&buf, "\n\n")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/notify"
+)
+
+var event = notify.Event{Type: notify.New, Profile: "kitchen", Rule: "island", Slab: slabfinder.Slab{
+	Color: "Taj Mahal", Lot: "6656", Length: 130, Width: 77, Vendor: slabfinder.Cosmos,
+	URL: "https://example.com/6656", Photo: "https://example.com/6656.jpg",
+}}
+
+// request is what the test server received.
+type request struct {
+	Method, Path, Body string
+	Header             map[string]string
+}
+
+// server records the requests it receives, and fails the first failures.
+func server(t *testing.T, failures int, headers ...string) (*httptest.Server, *[]request) {
+	var got []request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := request{Method: r.Method, Path: r.URL.Path, Body: string(body), Header: make(map[string]string)}
+		for _, h := range headers {
+			req.Header[h] = r.Header.Get(h)
+		}
+		got = append(got, req)
+		if len(got) <= failures {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &got
+}
+
+func TestNotify(t *testing.T) {
+	ts, got := server(t, 1, "Title", "Click", "X-Slabfinder-Signature")
+	n, err := New(Config{
+		URL:    ts.URL + "/{{.Profile}}",
+		Method: "put",
+		Headers: map[string]string{
+			"Title": "{{.Type}} {{.Slab.Color}} slab",
+			"Click": "{{.Slab.URL}}",
+		},
+		Body:     `{"lot": {{json .Slab.Lot}}, "length": {{.Slab.Length}}}`,
+		Secret:   "s3cret",
+		Attempts: 2,
+		Backoff:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), []notify.Event{event}); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"lot": "6656", "length": 130}`
+	want := request{
+		Method: "PUT",
+		Path:   "/kitchen",
+		Body:   body,
+		Header: map[string]string{
+			"Title":                  "New Taj Mahal slab",
+			"Click":                  "https://example.com/6656",
+			"X-Slabfinder-Signature": "sha256=" + Sign([]byte("s3cret"), []byte(body)),
+		},
+	}
+	// The first attempt fails, and is retried.
+	if diff := cmp.Diff([]request{want, want}, *got); diff != "" {
+		t.Errorf("requests:\n%s", diff)
+	}
+}
+
+func TestNotifyDefaultBody(t *testing.T) {
+	ts, got := server(t, 0)
+	n, err := New(Config{URL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), []notify.Event{event}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*got))
+	}
+	r := (*got)[0]
+	if r.Method != "POST" {
+		t.Errorf("method %s, want POST", r.Method)
+	}
+	for _, want := range []string{`"type":"New"`, `"rule":"island"`, `"Lot":"6656"`} {
+		if !strings.Contains(r.Body, want) {
+			t.Errorf("body does not contain %s: %s", want, r.Body)
+		}
+	}
+}
+
+func TestNotifyFails(t *testing.T) {
+	ts, got := server(t, 10)
+	n, err := New(Config{URL: ts.URL, Attempts: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), []notify.Event{event}); err == nil {
+		t.Errorf("a failed request was not reported")
+	}
+	if len(*got) != 3 {
+		t.Errorf("got %d attempts, want 3", len(*got))
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ts, got := server(t, 0)
+	n, err := New(Config{URL: ts.URL + "/slabs", Body: "{{.Message}}", Headers: map[string]string{"Priority": "high"}, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n.DryRun = &buf
+	if err := n.Notify(context.Background(), []notify.Event{event}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 0 {
+		t.Errorf("dry run sent %d requests", len(*got))
+	}
+	want := "POST " + ts.URL + "/slabs\nPriority: high\n\n" + event.String() + "\n\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("dry run output:\n%s", diff)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{}, "url must be set"},
+		{Config{URL: "https://ntfy.sh/{{.Profile"}, "unclosed action"},
+		{Config{URL: "https://ntfy.sh/slabs", Headers: map[string]string{"Title": "{{.Nope}"}}, "template: Title"},
+		{Config{URL: "https://ntfy.sh/slabs", Secret: "a", SecretFile: "b"}, "only one of secret"},
+	} {
+		err := tc.cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Validate(%+v) = %v, want %q", tc.cfg, err, tc.want)
+		}
+	}
+}
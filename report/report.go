@@ -0,0 +1,181 @@
+// Package report writes a static report of the interesting slabs, as one
+// self-contained HTML file, with no scripts or stylesheets to fetch, or as
+// Markdown.  The slabs are grouped by vendor and then color, longest first,
+// so it can be published on any static host, or emailed.
+package report
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/criteria"
+)
+
+// Report is the slabs which matched the criteria.
+type Report struct {
+	Generated time.Time
+	Slabs     int // how many slabs matched
+	Groups    []Group
+}
+
+// Group is the slabs of one color at one vendor.
+type Group struct {
+	Vendor slabfinder.Vendor
+	Color  string
+	Cards  []Card
+}
+
+// Card is one slab, and the rules it matched.
+type Card struct {
+	slabfinder.Slab
+	Rules []string
+}
+
+// New returns a Report of the slabs in stock which match any rule of c.
+func New(slabs []slabfinder.Slab, c criteria.Criteria, now time.Time) *Report {
+	r := &Report{Generated: now}
+	type key struct {
+		vendor slabfinder.Vendor
+		color  string
+	}
+	groups := make(map[key]*Group)
+	for _, s := range slabs {
+		if !s.Gone.IsZero() {
+			continue
+		}
+		rules := dedup(c.MatchAll(s))
+		if len(rules) == 0 {
+			continue
+		}
+		k := key{s.Vendor, s.Color}
+		g := groups[k]
+		if g == nil {
+			g = &Group{Vendor: s.Vendor, Color: s.Color}
+			groups[k] = g
+		}
+		g.Cards = append(g.Cards, Card{s, rules})
+		r.Slabs++
+	}
+	for _, g := range groups {
+		sort.Slice(g.Cards, func(i, j int) bool {
+			a, b := g.Cards[i], g.Cards[j]
+			if a.Length != b.Length {
+				return a.Length > b.Length
+			}
+			if a.Lot != b.Lot {
+				return a.Lot < b.Lot
+			}
+			return a.Bundle < b.Bundle
+		})
+		r.Groups = append(r.Groups, *g)
+	}
+	sort.Slice(r.Groups, func(i, j int) bool {
+		a, b := r.Groups[i], r.Groups[j]
+		if a.Vendor != b.Vendor {
+			return a.Vendor.String() < b.Vendor.String()
+		}
+		return a.Color < b.Color
+	})
+	return r
+}
+
+// dedup removes repeated names, since several profiles may name their rules
+// the same.
+func dedup(names []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// HTML writes the report as an HTML page.
+func (r *Report) HTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// Markdown writes the report as Markdown.
+func (r *Report) Markdown(w io.Writer) error {
+	return markdownTemplate.Execute(w, r)
+}
+
+var funcs = map[string]interface{}{
+	"date": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+	"join": strings.Join,
+	"plural": func(n int, noun string) string {
+		if n == 1 {
+			return "1 " + noun
+		}
+		return strconv.Itoa(n) + " " + noun + "s"
+	},
+	// escape escapes the characters which are special in Markdown text.
+	"escape": strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "|", `\|`, "<", "&lt;").Replace,
+	// url escapes the characters which would end a Markdown link.
+	"url": strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace,
+}
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("report").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Interesting slabs</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 0 1em 2em; color: #222; }
+.cards { display: grid; grid-template-columns: repeat(auto-fill, minmax(220px, 1fr)); gap: 1em; }
+.card { border: 1px solid #ddd; border-radius: 4px; overflow: hidden; font-size: .9em; }
+.card img { width: 100%; height: 160px; object-fit: cover; background: #eee; display: block; }
+.card div { padding: .5em; }
+</style>
+</head>
+<body>
+<h1>Interesting slabs</h1>
+<p>{{plural .Slabs "slab"}} in stock, as of {{date .Generated}}.</p>
+{{range .Groups}}
+<h2>{{.Color}} at {{.Vendor}}</h2>
+<div class="cards">
+{{range .Cards}}<div class="card">
+{{if .Photo}}<a href="{{.Photo}}"><img src="{{.Photo}}" alt="{{.Color}} lot {{.Lot}}" loading="lazy"></a>{{end}}
+<div>
+<strong>{{.Length}}" &times; {{.Width}}"</strong>, {{.Thickness}}cm {{.Finish}}<br>
+Lot {{.Lot}}{{if .Bundle}}, bundle {{.Bundle}}{{end}}, {{plural .Count "slab"}}<br>
+{{if .URL}}<a href="{{.URL}}">{{.Vendor}}</a>{{else}}{{.Vendor}}{{end}}{{if .Location}}, {{.Location}}{{end}}<br>
+First seen {{date .FirstSeen}}<br>
+Last seen {{date .LastSeen}}<br>
+Matches {{join .Rules ", "}}
+</div>
+</div>
+{{end}}</div>
+{{else}}
+<p>No slabs match.</p>
+{{end}}
+</body>
+</html>
+`))
+
+var markdownTemplate = template.Must(template.New("report").Funcs(funcs).Parse(`# Interesting slabs
+
+{{plural .Slabs "slab"}} in stock, as of {{date .Generated}}.
+{{range .Groups}}
+## {{escape .Color}} at {{.Vendor}}
+{{range .Cards}}
+{{if .Photo}}[![{{escape .Color}} lot {{escape .Lot}}]({{url .Photo}})]({{url .Photo}})
+
+{{end}}- **{{.Length}}" × {{.Width}}"**, {{.Thickness}}cm {{.Finish}}
+- Lot {{escape .Lot}}{{if .Bundle}}, bundle {{escape .Bundle}}{{end}}, {{plural .Count "slab"}}
+- {{if .URL}}[{{.Vendor}}]({{url .URL}}){{else}}{{.Vendor}}{{end}}{{if .Location}}, {{escape .Location}}{{end}}
+- First seen {{date .FirstSeen}}, last seen {{date .LastSeen}}
+- Matches {{escape (join .Rules ", ")}}
+{{end}}{{else}}
+No slabs match.
+{{end}}`))
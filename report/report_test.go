@@ -0,0 +1,105 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/criteria"
+)
+
+var now = time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+
+func testReport(t *testing.T) *Report {
+	t.Helper()
+	var c criteria.Criteria
+	rules := "- name: island\n  length: {min: 130}\n- name: island\n  color: Titanium\n- name: leathered\n  finish: [Leather]\n"
+	if err := yaml.Unmarshal([]byte(rules), &c); err != nil {
+		t.Fatal(err)
+	}
+	slabs := []slabfinder.Slab{
+		{Vendor: slabfinder.OHM, Color: "White Ice", Lot: "w1", Length: 131, Width: 70, FirstSeen: now, LastSeen: now},
+		{Vendor: slabfinder.Cosmos, Color: "Titanium", Lot: "t1", Length: 120, Width: 70, Finish: slabfinder.Leather, Count: 1,
+			URL: "https://example.com/t1", Photo: "https://example.com/t1 (front).jpg", FirstSeen: now.Add(-time.Hour), LastSeen: now},
+		{Vendor: slabfinder.Cosmos, Color: "Titanium", Lot: "t2", Length: 132, Width: 78, Count: 3, FirstSeen: now, LastSeen: now},
+		{Vendor: slabfinder.Cosmos, Color: "Titanium", Lot: "sold", Length: 140, FirstSeen: now, Gone: now},
+		{Vendor: slabfinder.Cosmos, Color: "Black_Pearl", Lot: "short", Length: 100},
+	}
+	return New(slabs, c, now)
+}
+
+func TestNew(t *testing.T) {
+	r := testReport(t)
+	var got [][]string
+	for _, g := range r.Groups {
+		group := []string{g.Vendor.String() + " " + g.Color}
+		for _, c := range g.Cards {
+			group = append(group, c.Lot+": "+strings.Join(c.Rules, ", "))
+		}
+		got = append(got, group)
+	}
+	want := [][]string{
+		{"Cosmos Titanium", "t2: island", "t1: island, leathered"},
+		{"OHM White Ice", "w1: island"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("groups:\n%s", diff)
+	}
+	if r.Slabs != 3 {
+		t.Errorf("Slabs = %d, want 3", r.Slabs)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport(t).HTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{
+		"3 slabs in stock",
+		"<h2>Titanium at Cosmos</h2>",
+		`<a href="https://example.com/t1">Cosmos</a>`,
+		`<img src="https://example.com/t1%20%28front%29.jpg"`,
+		"1 slab<br>",
+		`132" &times; 78"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML doesn't contain %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "sold") {
+		t.Errorf("HTML contains a slab which is gone:\n%s", html)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport(t).Markdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+	for _, want := range []string{
+		"## Titanium at Cosmos\n",
+		"[![Titanium lot t1](https://example.com/t1%20%28front%29.jpg)](https://example.com/t1%20%28front%29.jpg)",
+		"- [Cosmos](https://example.com/t1)\n",
+		"- Matches island, leathered\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown doesn't contain %q:\n%s", want, md)
+		}
+	}
+
+	var empty bytes.Buffer
+	if err := New(nil, nil, now).Markdown(&empty); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(empty.String(), "No slabs match.") {
+		t.Errorf("empty report:\n%s", empty.String())
+	}
+}
@@ -2,6 +2,8 @@ package slabfinder
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cespare/xxhash"
@@ -14,6 +16,7 @@ const (
 	UnknownVendor Vendor = 0
 	StoneBasyx    Vendor = 1
 	Cosmos        Vendor = 2
+	OHM           Vendor = 3
 
 	UnknownFinish Finish = 0
 	Polished      Finish = 1
@@ -21,7 +24,7 @@ const (
 	Honed         Finish = 3
 )
 
-// Slab describese one slab, which is in stock
+// Slab describese one slab, which is in stock, or was until Gone
 type Slab struct {
 	// TODO: add Material, if its ever other than Granite
 	Price     int // in pennies
@@ -33,15 +36,52 @@ type Slab struct {
 	Width     float64 // inches
 	Length    float64 // inches
 	Count     int     // how many slabs are in this set
+	Location  string  // the warehouse, for vendors with several
 	Vendor    Vendor  // who has this slab for sale
-	URL       string  // the detail page for the slab
-	Photo     string  // the URL to a photo of the slab
+	// Key is the vendor's own identifier for the slab, unique among its
+	// slabs, eg. the StoneBasyx product id, lot, bundle and warehouse
+	Key       string `json:",omitempty"`
+	URL       string // the detail page for the slab
+	Photo     string // the URL to a photo of the slab
+	Page      string `json:",omitempty"` // the vendor page which listed it, as in PageError
 	FirstSeen time.Time
 	LastSeen  time.Time
+	// Gone is when the slab was missing from a successful fetch of its
+	// Page, it is zero while the slab is in stock
+	Gone time.Time
+	// History is the changes to the slab since it was first seen, oldest
+	// first
+	History []Change `json:",omitempty"`
 }
 
+// IDVersion is the scheme used by ID for slabs with a Key.  Changing the
+// scheme changes every ID, so it needs a migration from LegacyID, or the
+// previous version, like the one in slabwatcher.
+const IDVersion = 2
+
+// ID identifies the slab among all vendors' slabs.  It is derived from the
+// vendor's Key, so it survives changes to the photo and other details, or
+// from LegacyID if the vendor doesn't supply a Key.
 func (s *Slab) ID() uint64 {
-	return xxhash.Sum64([]byte(fmt.Sprintf("%s%s%vd%s%s%s%s", s.Vendor, s.Finish, s.Thickness, s.Color, s.Lot, s.Bundle, s.Photo)))
+	if s.Key == "" {
+		return s.LegacyID()
+	}
+	return xxhash.Sum64([]byte(fmt.Sprintf("v%d/%s/%s", IDVersion, s.Vendor, s.Key)))
+}
+
+// LegacyID is the first version of ID, a hash of the slab's details.
+func (s *Slab) LegacyID() uint64 {
+	return xxhash.Sum64([]byte(fmt.Sprintf("%s%s%vd%s%s%s%s%s", s.Vendor, s.Finish, s.Thickness, s.Color, s.Lot, s.Bundle, s.Photo, s.Location)))
+}
+
+// FormatID formats a Slab.ID() as it appears in URLs and the API.
+func FormatID(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+// ParseID parses an ID formatted by FormatID.
+func ParseID(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
 }
 
 func (s *Slab) String() string {
@@ -54,6 +94,8 @@ func (v Vendor) String() string {
 		return "StoneBasyx"
 	case Cosmos:
 		return "Cosmos"
+	case OHM:
+		return "OHM"
 	}
 	return "UnknownVendor"
 }
@@ -69,3 +111,23 @@ func (f Finish) String() string {
 	}
 	return "UnknownPolish"
 }
+
+// ParseFinish returns the Finish with the given name, ignoring case.
+func ParseFinish(name string) (Finish, error) {
+	for _, f := range []Finish{Polished, Leather, Honed} {
+		if strings.EqualFold(name, f.String()) {
+			return f, nil
+		}
+	}
+	return UnknownFinish, fmt.Errorf("unknown finish: %q", name)
+}
+
+// ParseVendor returns the Vendor with the given name, ignoring case.
+func ParseVendor(name string) (Vendor, error) {
+	for _, v := range []Vendor{StoneBasyx, Cosmos, OHM} {
+		if strings.EqualFold(name, v.String()) {
+			return v, nil
+		}
+	}
+	return UnknownVendor, fmt.Errorf("unknown vendor: %q", name)
+}
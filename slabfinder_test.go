@@ -0,0 +1,27 @@
+package slabfinder
+
+import "testing"
+
+func TestID(t *testing.T) {
+	legacy := Slab{Vendor: Cosmos, Lot: "8907", Bundle: "195320", Photo: "a.jpg"}
+	keyed := legacy
+	keyed.Key = "8907/195320"
+
+	if legacy.ID() != legacy.LegacyID() {
+		t.Errorf("ID() of a slab without a Key is not its LegacyID()")
+	}
+	if keyed.ID() == keyed.LegacyID() {
+		t.Errorf("ID() of a slab with a Key is its LegacyID()")
+	}
+	moved := keyed
+	moved.Photo = "b.jpg"
+	moved.Count = 3
+	if moved.ID() != keyed.ID() {
+		t.Errorf("ID() changed with the photo")
+	}
+	other := keyed
+	other.Vendor = OHM
+	if other.ID() == keyed.ID() {
+		t.Errorf("the same Key at two vendors has the same ID()")
+	}
+}
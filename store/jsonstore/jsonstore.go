@@ -0,0 +1,253 @@
+// Package jsonstore keeps the latest state of the watcher in two JSON files,
+// one of the known slabs, and one of which profiles were notified about them.
+// It doesn't keep the observations of each Run.
+//
+// The files are replaced atomically, with hourly backups, and are locked
+// while the Store is open.
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/store"
+	"github.com/asjoyner/slabfinder/store/statefile"
+)
+
+// BackupEvery is how often the files are backed up.
+const BackupEvery = time.Hour
+
+// Store is a store.Store kept in JSON files.
+type Store struct {
+	slabsFile    *statefile.File
+	notifiedFile *statefile.File
+	lock         *statefile.Lock
+	slabs        map[uint64]slabfinder.Slab
+	notified     store.Notified
+}
+
+// Open locks and loads the slabs and notified files, keeping the given number
+// of backups of each.  If they don't exist yet, the Store is empty.
+func Open(slabsPath, notifiedPath string, backups int) (*Store, error) {
+	lock, err := statefile.Acquire(slabsPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		slabsFile:    &statefile.File{Path: slabsPath, Backups: backups, Every: BackupEvery},
+		notifiedFile: &statefile.File{Path: notifiedPath, Backups: backups, Every: BackupEvery},
+		lock:         lock,
+	}
+	if s.slabs, err = loadSlabs(s.slabsFile); err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	if s.notified, err = loadNotified(s.notifiedFile); err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenReadOnly loads the slabs and notified files without locking them, so
+// they can be read while the watcher is running.  A Tx can't be begun.
+func OpenReadOnly(slabsPath, notifiedPath string) (*Store, error) {
+	s := &Store{
+		slabsFile:    &statefile.File{Path: slabsPath},
+		notifiedFile: &statefile.File{Path: notifiedPath},
+	}
+	var err error
+	if s.slabs, err = loadSlabs(s.slabsFile); err != nil {
+		return nil, err
+	}
+	if s.notified, err = loadNotified(s.notifiedFile); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Slabs returns a copy of the known slabs.
+func (s *Store) Slabs() (map[uint64]slabfinder.Slab, error) {
+	slabs := make(map[uint64]slabfinder.Slab, len(s.slabs))
+	for id, slab := range s.slabs {
+		slabs[id] = slab
+	}
+	return slabs, nil
+}
+
+// Notified returns a copy of the notified records.
+func (s *Store) Notified() (store.Notified, error) {
+	notified := make(store.Notified, len(s.notified))
+	for profile, ids := range s.notified {
+		notified[profile] = make(map[uint64]time.Time, len(ids))
+		for id, t := range ids {
+			notified[profile][id] = t
+		}
+	}
+	return notified, nil
+}
+
+// Begin starts a Tx, the Run itself is not recorded.
+func (s *Store) Begin(r store.Run) (store.Tx, error) {
+	if s.lock == nil {
+		return nil, errors.New("the store is read only")
+	}
+	return &tx{s: s, puts: make(map[uint64]slabfinder.Slab), deletes: make(map[uint64]bool)}, nil
+}
+
+// Close releases the lock, every Tx is saved when it is committed.
+func (s *Store) Close() error {
+	if s.lock == nil {
+		return nil // opened read only
+	}
+	return s.lock.Unlock()
+}
+
+// notification is one call to Tx.Notify.
+type notification struct {
+	profile string
+	id      uint64
+	t       time.Time
+}
+
+// tx holds the changes until Commit applies them to the Store, and saves it.
+type tx struct {
+	s         *Store
+	puts      map[uint64]slabfinder.Slab
+	deletes   map[uint64]bool
+	notifies  []notification
+	committed bool
+}
+
+func (t *tx) PutSlab(id uint64, s slabfinder.Slab) error {
+	delete(t.deletes, id)
+	t.puts[id] = s
+	return nil
+}
+
+func (t *tx) DeleteSlab(id uint64) error {
+	delete(t.puts, id)
+	t.deletes[id] = true
+	return nil
+}
+
+// Observe does nothing, only the latest state of each slab is kept.
+func (t *tx) Observe(id uint64, s slabfinder.Slab) error {
+	return nil
+}
+
+func (t *tx) Notify(profile string, id uint64, when time.Time) error {
+	t.notifies = append(t.notifies, notification{profile, id, when})
+	return nil
+}
+
+// Commit applies the changes, and writes both files.  Each file is replaced
+// atomically, but not both together: the notified file is written first, so
+// a crash in between leaves profiles recorded as notified about slabs which
+// weren't saved.  Their notifications were already queued, so the next cycle
+// finds them as new slabs, without notifying anyone again, rather than
+// notifying twice.
+func (t *tx) Commit() error {
+	if t.committed {
+		return errors.New("transaction already committed")
+	}
+	t.committed = true
+	s := t.s
+	for id := range t.deletes {
+		delete(s.slabs, id)
+		for _, ids := range s.notified {
+			delete(ids, id)
+		}
+	}
+	for id, slab := range t.puts {
+		s.slabs[id] = slab
+	}
+	for _, n := range t.notifies {
+		if s.notified[n.profile] == nil {
+			s.notified[n.profile] = make(map[uint64]time.Time)
+		}
+		s.notified[n.profile][n.id] = n.t
+	}
+	if err := s.saveNotified(); err != nil {
+		return fmt.Errorf("writing notified slabs: %s", err)
+	}
+	if err := s.saveSlabs(); err != nil {
+		return fmt.Errorf("writing slabs: %s", err)
+	}
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.puts, t.deletes, t.notifies = nil, nil, nil
+	return nil
+}
+
+// loadSlabs loads the known slabs from disk.  If the file does not exist yet,
+// there are no known slabs.
+func loadSlabs(f *statefile.File) (map[uint64]slabfinder.Slab, error) {
+	slabs := make(map[uint64]slabfinder.Slab)
+	err := f.Read(func(input []byte) error {
+		slabs = make(map[uint64]slabfinder.Slab)
+		var ss []slabfinder.Slab
+		if err := json.Unmarshal(input, &ss); err != nil {
+			return err
+		}
+		for _, slab := range ss {
+			slabs[slab.ID()] = slab // recompute the ID each time, so changing it is less cumbersome
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("%s does not exist, starting with no known slabs", f.Path)
+		return slabs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading known slabs: %s", err)
+	}
+	return slabs, nil
+}
+
+func (s *Store) saveSlabs() error {
+	var ss []slabfinder.Slab
+	for _, slab := range s.slabs {
+		ss = append(ss, slab)
+	}
+	// Keep the file stable, so it diffs nicely.
+	sort.Slice(ss, func(i, j int) bool { return ss[i].ID() < ss[j].ID() })
+	output, err := json.MarshalIndent(ss, "", "	")
+	if err != nil {
+		return err
+	}
+	return s.slabsFile.Write(output)
+}
+
+// loadNotified reads which slabs each profile has been notified about.  If
+// the file does not exist yet, no profile has been notified.
+func loadNotified(f *statefile.File) (store.Notified, error) {
+	notified := make(store.Notified)
+	err := f.Read(func(input []byte) error {
+		notified = make(store.Notified)
+		return json.Unmarshal(input, &notified)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return notified, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading notified slabs: %s", err)
+	}
+	return notified, nil
+}
+
+func (s *Store) saveNotified() error {
+	output, err := json.MarshalIndent(s.notified, "", "	")
+	if err != nil {
+		return err
+	}
+	return s.notifiedFile.Write(output)
+}
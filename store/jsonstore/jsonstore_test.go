@@ -0,0 +1,104 @@
+package jsonstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/store"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	slabsPath, notifiedPath := filepath.Join(dir, "slabs.json"), filepath.Join(dir, "notified.json")
+	s, err := Open(slabsPath, notifiedPath, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	a := slabfinder.Slab{Vendor: slabfinder.Cosmos, Key: "8907/195320", Lot: "8907", FirstSeen: now, LastSeen: now}
+	b := slabfinder.Slab{Vendor: slabfinder.OHM, Lot: "46420", FirstSeen: now, LastSeen: now}
+	tx, err := s.Begin(store.Run{Time: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.PutSlab(a.ID(), a)
+	tx.PutSlab(b.ID(), b)
+	tx.Notify("kitchen", a.ID(), now)
+	tx.Notify("kitchen", b.ID(), now)
+
+	// Nothing is saved until the commit.
+	if _, err := os.Stat(slabsPath); err == nil {
+		t.Errorf("%s was written before the commit", slabsPath)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = s.Begin(store.Run{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.DeleteSlab(b.ID())
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files are locked until the Store is closed.
+	if _, err := Open(slabsPath, notifiedPath, 2); err == nil {
+		t.Errorf("opened the store twice")
+	}
+	// But they can be read.
+	ro, err := OpenReadOnly(slabsPath, notifiedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slabs, _ := ro.Slabs(); len(slabs) != 1 {
+		t.Errorf("read only store has %d slabs, want 1", len(slabs))
+	}
+	if _, err := ro.Begin(store.Run{}); err == nil {
+		t.Errorf("began a Tx in a read only store")
+	}
+	ro.Close()
+	s.Close()
+	s, err = Open(slabsPath, notifiedPath, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slabs, err := s.Slabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[uint64]slabfinder.Slab{a.ID(): a}, slabs); diff != "" {
+		t.Errorf("slabs:\n%s", diff)
+	}
+	notified, err := s.Notified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(store.Notified{"kitchen": {a.ID(): now}}, notified); diff != "" {
+		t.Errorf("notified:\n%s", diff)
+	}
+	s.Close()
+
+	// A damaged file is recovered from the backup made before the delete.
+	if err := os.WriteFile(slabsPath, []byte(`[{"Lot": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(slabsPath, notifiedPath, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	slabs, err = s.Slabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[uint64]slabfinder.Slab{a.ID(): a, b.ID(): b}, slabs); diff != "" {
+		t.Errorf("recovered slabs:\n%s", diff)
+	}
+}
@@ -0,0 +1,181 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/store"
+)
+
+// OpenReadOnly opens the database at path for queries, without locking it, so
+// they can be made while the watcher is running.  Its schema must be up to
+// date, and a Tx can't be committed.
+func OpenReadOnly(path string) (*Store, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	v, err := s.Version()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("reading %s: %s", path, err)
+	}
+	if v != len(migrations) {
+		db.Close()
+		return nil, fmt.Errorf("%s has schema version %d, not %d, run slabwatcher to upgrade it", path, v, len(migrations))
+	}
+	return s, nil
+}
+
+// bound returns a column value to compare times with.  Unlike formatTime, a
+// zero time is the earliest time, not NULL.
+func bound(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// Runs returns the Runs from from to to, inclusive, oldest first.
+func (s *Store) Runs(from, to time.Time) ([]store.Run, error) {
+	rows, err := s.db.Query(`SELECT r.id, r.time, v.fetcher, v.vendor, v.slabs, v.duration_ms, v.error
+		FROM runs r LEFT JOIN run_vendors v ON v.run_id = r.id
+		WHERE r.time >= ? AND r.time <= ? ORDER BY r.time, r.id, v.fetcher`, bound(from), bound(to))
+	if err != nil {
+		return nil, fmt.Errorf("reading runs: %s", err)
+	}
+	defer rows.Close()
+	var runs []store.Run
+	var last int64
+	for rows.Next() {
+		var id int64
+		var t string
+		var fetcher, vendor, verr sql.NullString
+		var slabs, duration sql.NullInt64
+		if err := rows.Scan(&id, &t, &fetcher, &vendor, &slabs, &duration, &verr); err != nil {
+			return nil, fmt.Errorf("reading runs: %s", err)
+		}
+		if len(runs) == 0 || id != last {
+			runs = append(runs, store.Run{Time: parseTime(sql.NullString{String: t, Valid: true})})
+			last = id
+		}
+		if !fetcher.Valid {
+			continue // a Run with no vendors
+		}
+		v := store.VendorStatus{
+			Fetcher:  fetcher.String,
+			Slabs:    int(slabs.Int64),
+			Duration: time.Duration(duration.Int64) * time.Millisecond,
+			Err:      verr.String,
+		}
+		v.Vendor, _ = slabfinder.ParseVendor(vendor.String)
+		r := &runs[len(runs)-1]
+		r.Vendors = append(r.Vendors, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading runs: %s", err)
+	}
+	return runs, nil
+}
+
+// Inventory returns the slabs in stock at t.
+func (s *Store) Inventory(t time.Time) ([]slabfinder.Slab, error) {
+	// The latest run by t which fetched each vendor successfully.  SQLite
+	// takes the bare r.id from the row with the MAX.
+	rows, err := s.db.Query(`SELECT v.vendor, r.id, MAX(r.time) FROM runs r JOIN run_vendors v ON v.run_id = r.id
+		WHERE r.time <= ? AND v.error = '' GROUP BY v.vendor ORDER BY v.vendor`, bound(t))
+	if err != nil {
+		return nil, fmt.Errorf("reading inventory: %s", err)
+	}
+	type latest struct {
+		vendor string
+		run    int64
+	}
+	var runs []latest
+	for rows.Next() {
+		var l latest
+		var max string
+		if err := rows.Scan(&l.vendor, &l.run, &max); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("reading inventory: %s", err)
+		}
+		runs = append(runs, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading inventory: %s", err)
+	}
+
+	var slabs []slabfinder.Slab
+	for _, l := range runs {
+		rows, err := s.db.Query(`SELECT `+slabColumns+`, o.count, o.price, o.length, o.width, r.time
+			FROM observations o JOIN slabs s ON s.id = o.slab_id JOIN runs r ON r.id = o.run_id
+			WHERE o.run_id = ? AND s.vendor = ? ORDER BY s.color, s.lot, s.bundle, s.location`, l.run, l.vendor)
+		if err != nil {
+			return nil, fmt.Errorf("reading inventory: %s", err)
+		}
+		for rows.Next() {
+			var o slabfinder.Slab
+			var seen string
+			_, slab, err := scanSlab(rows, &o.Count, &o.Price, &o.Length, &o.Width, &seen)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("reading inventory: %s", err)
+			}
+			slab.Count, slab.Price, slab.Length, slab.Width = o.Count, o.Price, o.Length, o.Width
+			slabs = append(slabs, asOf(slab, parseTime(sql.NullString{String: seen, Valid: true}), t))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("reading inventory: %s", err)
+		}
+	}
+	return slabs, nil
+}
+
+// asOf returns the slab as it was when it was observed at seen, which was the
+// last observation before t.
+func asOf(slab slabfinder.Slab, seen, t time.Time) slabfinder.Slab {
+	slab.LastSeen = seen
+	slab.Gone = time.Time{}
+	var history []slabfinder.Change
+	for _, c := range slab.History {
+		if !c.Time.After(t) {
+			history = append(history, c)
+		}
+	}
+	slab.History = history
+	return slab
+}
+
+// Stock returns the stock of each vendor's colors in each Run.
+func (s *Store) Stock(from, to time.Time) ([]store.Stock, error) {
+	rows, err := s.db.Query(`SELECT r.time, s.vendor, s.color, COUNT(*), SUM(o.count)
+		FROM observations o JOIN runs r ON r.id = o.run_id JOIN slabs s ON s.id = o.slab_id
+		WHERE r.time >= ? AND r.time <= ? AND EXISTS (
+			SELECT 1 FROM run_vendors v WHERE v.run_id = r.id AND v.vendor = s.vendor AND v.error = '')
+		GROUP BY r.id, s.vendor, s.color ORDER BY r.time, s.vendor, s.color`, bound(from), bound(to))
+	if err != nil {
+		return nil, fmt.Errorf("reading stock: %s", err)
+	}
+	defer rows.Close()
+	var stock []store.Stock
+	for rows.Next() {
+		var st store.Stock
+		var t, vendor string
+		if err := rows.Scan(&t, &vendor, &st.Color, &st.Bundles, &st.Slabs); err != nil {
+			return nil, fmt.Errorf("reading stock: %s", err)
+		}
+		st.Time = parseTime(sql.NullString{String: t, Valid: true})
+		st.Vendor, _ = slabfinder.ParseVendor(vendor)
+		stock = append(stock, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading stock: %s", err)
+	}
+	return stock, nil
+}
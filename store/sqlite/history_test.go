@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/store"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slabs.db")
+	s, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 6, 0, 0, 0, time.UTC) }
+	a := slabfinder.Slab{Vendor: slabfinder.Cosmos, Key: "1/1", Color: "Titanium", Lot: "1", Bundle: "1", Count: 4, Length: 130, FirstSeen: day(1)}
+	b := slabfinder.Slab{Vendor: slabfinder.Cosmos, Key: "2/2", Color: "Titanium", Lot: "2", Bundle: "2", Count: 2, Length: 120, FirstSeen: day(1)}
+	c := slabfinder.Slab{Vendor: slabfinder.OHM, Key: "3/Charlotte", Color: "White", Lot: "3", Count: 5, FirstSeen: day(1)}
+	cosmos := func(err string) store.VendorStatus {
+		return store.VendorStatus{Fetcher: "cosmos", Vendor: slabfinder.Cosmos, Err: err}
+	}
+	ohm := func(err string) store.VendorStatus {
+		return store.VendorStatus{Fetcher: "ohm", Vendor: slabfinder.OHM, Err: err}
+	}
+	// cycle saves a Run the way the watcher does, seen slabs are observed.
+	cycle := func(r store.Run, seen, gone []slabfinder.Slab) {
+		t.Helper()
+		tx, err := s.Begin(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, slab := range seen {
+			slab.LastSeen = r.Time
+			if err := tx.PutSlab(slab.ID(), slab); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Observe(slab.ID(), slab); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, slab := range gone {
+			slab.Gone = r.Time
+			if err := tx.PutSlab(slab.ID(), slab); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cycle(store.Run{Time: day(1), Vendors: []store.VendorStatus{cosmos(""), ohm("")}}, []slabfinder.Slab{a, b, c}, nil)
+	a2 := a
+	a2.Count = 3
+	a2.History = []slabfinder.Change{{Time: day(2), Kind: slabfinder.CountDecreased, Field: "Count", Old: "4", New: "3"}}
+	b.LastSeen = day(1)
+	cycle(store.Run{Time: day(2), Vendors: []store.VendorStatus{cosmos(""), ohm("timeout")}}, []slabfinder.Slab{a2}, []slabfinder.Slab{b})
+	cycle(store.Run{Time: day(3), Vendors: []store.VendorStatus{cosmos("timeout"), ohm("")}}, []slabfinder.Slab{c}, nil)
+
+	// Queries work while the watcher has the database open.
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	seen := func(s slabfinder.Slab, t time.Time) slabfinder.Slab {
+		s.LastSeen = t
+		return s
+	}
+	for _, tc := range []struct {
+		at   time.Time
+		want []slabfinder.Slab
+	}{
+		{day(1).Add(-time.Hour), nil},
+		{day(1), []slabfinder.Slab{seen(a, day(1)), seen(b, day(1)), seen(c, day(1))}},
+		// The history of a stops before it was changed.
+		{day(2).Add(-time.Hour), []slabfinder.Slab{seen(a, day(1)), seen(b, day(1)), seen(c, day(1))}},
+		// ohm failed on day 2, so its slabs are from day 1.
+		{day(2), []slabfinder.Slab{seen(a2, day(2)), seen(c, day(1))}},
+		// cosmos failed on day 3, so its slabs are from day 2.
+		{day(3), []slabfinder.Slab{seen(a2, day(2)), seen(c, day(3))}},
+	} {
+		got, err := ro.Inventory(tc.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("Inventory(%s):\n%s", tc.at, diff)
+		}
+	}
+
+	stock, err := ro.Stock(time.Time{}, day(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStock := []store.Stock{
+		{Time: day(1), Vendor: slabfinder.Cosmos, Color: "Titanium", Bundles: 2, Slabs: 6},
+		{Time: day(1), Vendor: slabfinder.OHM, Color: "White", Bundles: 1, Slabs: 5},
+		{Time: day(2), Vendor: slabfinder.Cosmos, Color: "Titanium", Bundles: 1, Slabs: 3},
+		{Time: day(3), Vendor: slabfinder.OHM, Color: "White", Bundles: 1, Slabs: 5},
+	}
+	if diff := cmp.Diff(wantStock, stock); diff != "" {
+		t.Errorf("Stock():\n%s", diff)
+	}
+
+	runs, err := ro.Runs(day(2), day(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRuns := []store.Run{
+		{Time: day(2), Vendors: []store.VendorStatus{cosmos(""), ohm("timeout")}},
+		{Time: day(3), Vendors: []store.VendorStatus{cosmos("timeout"), ohm("")}},
+	}
+	if diff := cmp.Diff(wantRuns, runs); diff != "" {
+		t.Errorf("Runs():\n%s", diff)
+	}
+
+	if _, err := ro.Begin(store.Run{Time: day(4)}); err == nil {
+		t.Errorf("began a run in a read only database")
+	}
+}
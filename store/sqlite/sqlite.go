@@ -0,0 +1,479 @@
+// Package sqlite keeps the watcher's state in an SQLite database, using a
+// pure Go driver, so slabwatcher still builds without cgo.
+//
+// Besides the latest state of each slab, it records every Run, with the
+// status of each vendor and an observation of each slab fetched, so the
+// inventory can be queried over time.  The schema is upgraded by Open, using
+// the user_version pragma to track which migrations have been applied.
+//
+// The database is backed up hourly, and restored from the newest good backup
+// if it is damaged.  It is locked while the Store is open.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"modernc.org/sqlite" // registers the "sqlite" driver
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/store"
+	"github.com/asjoyner/slabfinder/store/statefile"
+)
+
+// migrations are applied in order, each in its own transaction.  Never edit
+// one which has been released, add another.
+var migrations = []string{
+	`CREATE TABLE slabs (
+		id         INTEGER PRIMARY KEY, -- Slab.ID(), as a signed integer
+		vendor     TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		color      TEXT NOT NULL,
+		finish     TEXT NOT NULL,
+		thickness  REAL NOT NULL,
+		lot        TEXT NOT NULL,
+		bundle     TEXT NOT NULL,
+		width      REAL NOT NULL,
+		length     REAL NOT NULL,
+		count      INTEGER NOT NULL,
+		price      INTEGER NOT NULL,
+		location   TEXT NOT NULL,
+		url        TEXT NOT NULL,
+		photo      TEXT NOT NULL,
+		first_seen TEXT,
+		last_seen  TEXT,
+		gone       TEXT,
+		history    TEXT NOT NULL -- JSON list of slabfinder.Change
+	);
+	CREATE TABLE runs (
+		id   INTEGER PRIMARY KEY AUTOINCREMENT,
+		time TEXT NOT NULL
+	);
+	CREATE TABLE run_vendors (
+		run_id      INTEGER NOT NULL REFERENCES runs (id),
+		fetcher     TEXT NOT NULL,
+		vendor      TEXT NOT NULL,
+		slabs       INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		error       TEXT NOT NULL,
+		PRIMARY KEY (run_id, fetcher)
+	);
+	CREATE TABLE observations (
+		run_id  INTEGER NOT NULL REFERENCES runs (id),
+		slab_id INTEGER NOT NULL,
+		count   INTEGER NOT NULL,
+		price   INTEGER NOT NULL,
+		length  REAL NOT NULL,
+		width   REAL NOT NULL,
+		PRIMARY KEY (run_id, slab_id)
+	);
+	CREATE INDEX observations_slab ON observations (slab_id);
+	CREATE TABLE notifications (
+		profile TEXT NOT NULL,
+		slab_id INTEGER NOT NULL,
+		time    TEXT NOT NULL,
+		PRIMARY KEY (profile, slab_id)
+	);`,
+	`CREATE INDEX runs_time ON runs (time);`,
+	`ALTER TABLE slabs ADD COLUMN page TEXT NOT NULL DEFAULT '';`,
+}
+
+// timeFormat sorts in time order, as long as every time is in UTC.
+const timeFormat = "2006-01-02 15:04:05.000000000"
+
+// BackupEvery is how often the database is backed up.
+const BackupEvery = time.Hour
+
+// Store is a store.Store kept in an SQLite database.
+type Store struct {
+	db      *sql.DB
+	backups *statefile.File
+	lock    *statefile.Lock
+}
+
+// Open locks and opens the database at path, creating it if it doesn't exist,
+// and applies any migrations it hasn't had yet.  It keeps the given number of
+// backups.
+func Open(path string, backups int) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating database directory: %s", err)
+	}
+	lock, err := statefile.Acquire(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		backups: &statefile.File{Path: path, Backups: backups, Every: BackupEvery},
+		lock:    lock,
+	}
+	if s.db, err = open(path); err != nil {
+		if !corrupt(err) {
+			lock.Unlock()
+			return nil, fmt.Errorf("opening %s: %s", path, err)
+		}
+		log.Printf("%s is damaged: %s", path, err)
+		if s.db, err = s.restore(); err != nil {
+			lock.Unlock()
+			return nil, err
+		}
+	}
+	if err := s.migrate(); err != nil {
+		s.db.Close()
+		lock.Unlock()
+		return nil, fmt.Errorf("migrating %s: %s", path, err)
+	}
+	return s, nil
+}
+
+// open opens the database at path, and checks it isn't damaged.
+func open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if result != "ok" {
+		db.Close()
+		return nil, checkError(result)
+	}
+	return db, nil
+}
+
+// checkError is the result of a failed quick_check.
+type checkError string
+
+func (e checkError) Error() string { return string(e) }
+
+// corrupt reports whether an error from open means the database is corrupt,
+// or isn't a database at all, rather than that it can't be used right now,
+// eg. because it is busy, can't be read, or the disk is full.
+func corrupt(err error) bool {
+	var check checkError
+	if errors.As(err, &check) {
+		return true
+	}
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Code() & 0xff { // the primary result code
+	case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+		return true
+	}
+	return false
+}
+
+// damagedPath returns where to move the damaged database at path, without
+// replacing one which was moved aside before.
+func damagedPath(path string, now time.Time) string {
+	damaged := path + ".damaged"
+	if _, err := os.Lstat(damaged); errors.Is(err, fs.ErrNotExist) {
+		return damaged
+	}
+	return fmt.Sprintf("%s.%s", damaged, now.UTC().Format("20060102T150405.000000000Z"))
+}
+
+// restore moves the damaged database aside, and replaces it with the newest
+// backup which isn't damaged.
+func (s *Store) restore() (*sql.DB, error) {
+	path := s.backups.Path
+	backups, err := s.backups.List()
+	if err != nil {
+		return nil, err
+	}
+	damaged := damagedPath(path, time.Now())
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, damaged+suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("moving damaged database aside: %s", err)
+		}
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(backups[i])
+		if err == nil {
+			err = statefile.WriteFile(path, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("restoring %s: %s", backups[i], err)
+		}
+		db, err := open(path)
+		if err != nil {
+			log.Printf("backup %s is damaged: %s", backups[i], err)
+			os.Remove(path)
+			continue
+		}
+		log.Printf("restored %s from %s, the damaged database is %s", path, backups[i], damaged)
+		return db, nil
+	}
+	return nil, fmt.Errorf("%s is damaged, and there is no good backup, it was moved to %s", path, damaged)
+}
+
+// backup writes a copy of the database, if one is due.
+func (s *Store) backup() error {
+	return s.backups.Backup(func(dst string) error {
+		_, err := s.db.Exec("VACUUM INTO ?", dst)
+		return err
+	})
+}
+
+// Version returns the number of migrations applied to the database.
+func (s *Store) Version() (int, error) {
+	var v int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&v)
+	return v, err
+}
+
+func (s *Store) migrate() error {
+	v, err := s.Version()
+	if err != nil {
+		return err
+	}
+	if v > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this slabwatcher, which knows %d", v, len(migrations))
+	}
+	for ; v < len(migrations); v++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %s", v+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slabColumns are the columns of the slabs table read by scanSlab.
+const slabColumns = `s.id, s.vendor, s.key, s.color, s.finish, s.thickness, s.lot, s.bundle, s.width, s.length,
+	s.count, s.price, s.location, s.url, s.photo, s.page, s.first_seen, s.last_seen, s.gone, s.history`
+
+// scanSlab reads a row which starts with the slabColumns, and then any extra
+// columns, into dest.
+func scanSlab(rows *sql.Rows, dest ...interface{}) (uint64, slabfinder.Slab, error) {
+	var id int64
+	var slab slabfinder.Slab
+	var vendor, finish, history string
+	var firstSeen, lastSeen, gone sql.NullString
+	cols := []interface{}{&id, &vendor, &slab.Key, &slab.Color, &finish, &slab.Thickness, &slab.Lot,
+		&slab.Bundle, &slab.Width, &slab.Length, &slab.Count, &slab.Price, &slab.Location, &slab.URL,
+		&slab.Photo, &slab.Page, &firstSeen, &lastSeen, &gone, &history}
+	if err := rows.Scan(append(cols, dest...)...); err != nil {
+		return 0, slab, err
+	}
+	slab.Vendor, _ = slabfinder.ParseVendor(vendor)
+	slab.Finish, _ = slabfinder.ParseFinish(finish)
+	slab.FirstSeen = parseTime(firstSeen)
+	slab.LastSeen = parseTime(lastSeen)
+	slab.Gone = parseTime(gone)
+	if err := json.Unmarshal([]byte(history), &slab.History); err != nil {
+		return 0, slab, fmt.Errorf("parsing history of slab %016x: %s", uint64(id), err)
+	}
+	if len(slab.History) == 0 {
+		slab.History = nil
+	}
+	return uint64(id), slab, nil
+}
+
+// Slabs returns all the known slabs.
+func (s *Store) Slabs() (map[uint64]slabfinder.Slab, error) {
+	rows, err := s.db.Query(`SELECT ` + slabColumns + ` FROM slabs s`)
+	if err != nil {
+		return nil, fmt.Errorf("reading known slabs: %s", err)
+	}
+	defer rows.Close()
+	slabs := make(map[uint64]slabfinder.Slab)
+	for rows.Next() {
+		id, slab, err := scanSlab(rows)
+		if err != nil {
+			return nil, fmt.Errorf("reading known slabs: %s", err)
+		}
+		slabs[id] = slab
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading known slabs: %s", err)
+	}
+	return slabs, nil
+}
+
+// Notified returns which slabs each profile has been notified about.
+func (s *Store) Notified() (store.Notified, error) {
+	rows, err := s.db.Query(`SELECT profile, slab_id, time FROM notifications`)
+	if err != nil {
+		return nil, fmt.Errorf("reading notified slabs: %s", err)
+	}
+	defer rows.Close()
+	notified := make(store.Notified)
+	for rows.Next() {
+		var profile string
+		var id int64
+		var t sql.NullString
+		if err := rows.Scan(&profile, &id, &t); err != nil {
+			return nil, fmt.Errorf("reading notified slabs: %s", err)
+		}
+		if notified[profile] == nil {
+			notified[profile] = make(map[uint64]time.Time)
+		}
+		notified[profile][uint64(id)] = parseTime(t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading notified slabs: %s", err)
+	}
+	return notified, nil
+}
+
+// Begin starts a transaction, and records the Run in it.  A Run with a zero
+// Time is not recorded, for changes made outside a cycle, and nothing can be
+// observed in it.
+func (s *Store) Begin(r store.Run) (store.Tx, error) {
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	t := &tx{tx: sqlTx, s: s}
+	if r.Time.IsZero() {
+		return t, nil
+	}
+	res, err := sqlTx.Exec(`INSERT INTO runs (time) VALUES (?)`, formatTime(r.Time))
+	if err != nil {
+		sqlTx.Rollback()
+		return nil, fmt.Errorf("recording run: %s", err)
+	}
+	if t.run, err = res.LastInsertId(); err != nil {
+		sqlTx.Rollback()
+		return nil, fmt.Errorf("recording run: %s", err)
+	}
+	for _, v := range r.Vendors {
+		if _, err := sqlTx.Exec(`INSERT INTO run_vendors (run_id, fetcher, vendor, slabs, duration_ms, error)
+			VALUES (?, ?, ?, ?, ?, ?)`, t.run, v.Fetcher, v.Vendor.String(), v.Slabs, v.Duration.Milliseconds(), v.Err); err != nil {
+			sqlTx.Rollback()
+			return nil, fmt.Errorf("recording run: %s", err)
+		}
+	}
+	return t, nil
+}
+
+// Close closes the database, and releases the lock.
+func (s *Store) Close() error {
+	err := s.db.Close()
+	if s.lock == nil {
+		return err // opened read only
+	}
+	if lerr := s.lock.Unlock(); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+// tx is a store.Tx in an SQL transaction.
+type tx struct {
+	s   *Store
+	tx  *sql.Tx
+	run int64 // the ID of the Run in the runs table, or 0
+}
+
+func (t *tx) PutSlab(id uint64, s slabfinder.Slab) error {
+	history, err := json.Marshal(s.History)
+	if err != nil {
+		return err
+	}
+	if s.History == nil {
+		history = []byte("[]")
+	}
+	_, err = t.tx.Exec(`INSERT OR REPLACE INTO slabs (id, vendor, key, color, finish, thickness, lot, bundle,
+		width, length, count, price, location, url, photo, page, first_seen, last_seen, gone, history)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		int64(id), s.Vendor.String(), s.Key, s.Color, s.Finish.String(), s.Thickness, s.Lot, s.Bundle,
+		s.Width, s.Length, s.Count, s.Price, s.Location, s.URL, s.Photo, s.Page,
+		formatTime(s.FirstSeen), formatTime(s.LastSeen), formatTime(s.Gone), string(history))
+	if err != nil {
+		return fmt.Errorf("saving slab %016x: %s", id, err)
+	}
+	return nil
+}
+
+func (t *tx) DeleteSlab(id uint64) error {
+	if _, err := t.tx.Exec(`DELETE FROM notifications WHERE slab_id = ?`, int64(id)); err != nil {
+		return fmt.Errorf("deleting slab %016x: %s", id, err)
+	}
+	if _, err := t.tx.Exec(`DELETE FROM slabs WHERE id = ?`, int64(id)); err != nil {
+		return fmt.Errorf("deleting slab %016x: %s", id, err)
+	}
+	return nil
+}
+
+func (t *tx) Observe(id uint64, s slabfinder.Slab) error {
+	if t.run == 0 {
+		return errors.New("observing a slab outside a run")
+	}
+	if _, err := t.tx.Exec(`INSERT OR REPLACE INTO observations (run_id, slab_id, count, price, length, width)
+		VALUES (?, ?, ?, ?, ?, ?)`, t.run, int64(id), s.Count, s.Price, s.Length, s.Width); err != nil {
+		return fmt.Errorf("observing slab %016x: %s", id, err)
+	}
+	return nil
+}
+
+func (t *tx) Notify(profile string, id uint64, when time.Time) error {
+	if _, err := t.tx.Exec(`INSERT OR REPLACE INTO notifications (profile, slab_id, time) VALUES (?, ?, ?)`,
+		profile, int64(id), formatTime(when)); err != nil {
+		return fmt.Errorf("recording notification of slab %016x: %s", id, err)
+	}
+	return nil
+}
+
+// Commit saves the changes, and then backs up the database if it is due.
+// The changes are saved even if the backup fails, so that is only logged.
+func (t *tx) Commit() error {
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+	if err := t.s.backup(); err != nil {
+		log.Print(err)
+	}
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	if err := t.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
+
+// formatTime returns a column value for t, NULL if it is zero.
+func formatTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(timeFormat)
+}
+
+func parseTime(s sql.NullString) time.Time {
+	if !s.Valid {
+		return time.Time{}
+	}
+	t, err := time.Parse(timeFormat, s.String)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,194 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/asjoyner/slabfinder"
+	"github.com/asjoyner/slabfinder/store"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slabs.db")
+	s, err := Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 9, 1, 12, 0, 0, 123, time.UTC)
+	slab := slabfinder.Slab{
+		Vendor: slabfinder.Cosmos, Key: "8907/195320", Color: "Titanium", Finish: slabfinder.Leather,
+		Thickness: 3, Lot: "8907", Bundle: "195320", Width: 77.5, Length: 130, Count: 4, Price: 120000,
+		Location: "Charlotte", URL: "https://example.com/8907", Photo: "https://example.com/8907.jpg", Page: "Titanium",
+		FirstSeen: now.Add(-time.Hour), LastSeen: now,
+		History: []slabfinder.Change{{Time: now, Kind: slabfinder.CountDecreased, Field: "Count", Old: "5", New: "4"}},
+	}
+	gone := slabfinder.Slab{Vendor: slabfinder.OHM, Lot: "46420", FirstSeen: now.Add(-time.Hour), LastSeen: now.Add(-time.Hour), Gone: now}
+	run := store.Run{Time: now, Vendors: []store.VendorStatus{
+		{Fetcher: "cosmos", Vendor: slabfinder.Cosmos, Slabs: 1, Duration: time.Second},
+		{Fetcher: "ohm", Vendor: slabfinder.OHM, Err: "connection refused"},
+	}}
+	tx, err := s.Begin(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		tx.PutSlab(slab.ID(), slab),
+		tx.Observe(slab.ID(), slab),
+		tx.PutSlab(gone.ID(), gone),
+		tx.Notify("kitchen", slab.ID(), now),
+		tx.Notify("kitchen", gone.ID(), now),
+		tx.Commit(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A rolled back transaction changes nothing.
+	tx, err = s.Begin(store.Run{Time: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.DeleteSlab(slab.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Everything is there after reopening.
+	s, err = Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if v, err := s.Version(); err != nil || v != len(migrations) {
+		t.Errorf("Version() = %d, %v, want %d", v, err, len(migrations))
+	}
+	slabs, err := s.Slabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]slabfinder.Slab{slab.ID(): slab, gone.ID(): gone}
+	if diff := cmp.Diff(want, slabs); diff != "" {
+		t.Errorf("slabs:\n%s", diff)
+	}
+	notified, err := s.Notified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNotified := store.Notified{"kitchen": {slab.ID(): now, gone.ID(): now}}
+	if diff := cmp.Diff(wantNotified, notified); diff != "" {
+		t.Errorf("notified:\n%s", diff)
+	}
+	var runs, vendors, observations int
+	s.db.QueryRow(`SELECT COUNT(*) FROM runs`).Scan(&runs)
+	s.db.QueryRow(`SELECT COUNT(*) FROM run_vendors`).Scan(&vendors)
+	s.db.QueryRow(`SELECT COUNT(*) FROM observations`).Scan(&observations)
+	if runs != 1 || vendors != 2 || observations != 1 {
+		t.Errorf("got %d runs, %d vendors and %d observations, want 1, 2 and 1", runs, vendors, observations)
+	}
+
+	// Deleting a slab forgets who was notified about it.
+	tx, err = s.Begin(store.Run{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Observe(slab.ID(), slab); err == nil {
+		t.Errorf("observed a slab outside a run")
+	}
+	if err := tx.DeleteSlab(gone.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	notified, err = s.Notified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNotified = store.Notified{"kitchen": {slab.ID(): now}}
+	if diff := cmp.Diff(wantNotified, notified); diff != "" {
+		t.Errorf("notified after delete:\n%s", diff)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slabs.db")
+	s, err := Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	slab := slabfinder.Slab{Vendor: slabfinder.Cosmos, Key: "8907/195320", Lot: "8907", FirstSeen: now, LastSeen: now}
+	tx, err := s.Begin(store.Run{Time: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.PutSlab(slab.ID(), slab); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if err := os.WriteFile(path, []byte("not a database, but long enough to look like a header"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	slabs, err := s.Slabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[uint64]slabfinder.Slab{slab.ID(): slab}, slabs); diff != "" {
+		t.Errorf("restored slabs:\n%s", diff)
+	}
+	if _, err := os.Stat(path + ".damaged"); err != nil {
+		t.Errorf("the damaged database was not kept: %s", err)
+	}
+	s.Close()
+
+	// Damaging it again doesn't replace the first damaged copy.
+	if err := os.WriteFile(path, []byte("damaged again, and long enough to look like a header"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Open(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	damaged, err := filepath.Glob(path + ".damaged*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(damaged) != 2 {
+		t.Errorf("damaged copies: %q, want 2", damaged)
+	}
+}
+
+func TestOpenError(t *testing.T) {
+	// A database which can't be opened isn't necessarily damaged, so it is
+	// left alone.
+	path := filepath.Join(t.TempDir(), "slabs.db")
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := Open(path, 2); err == nil {
+		s.Close()
+		t.Fatalf("opened a directory")
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+		t.Errorf("the database was moved: %v", err)
+	}
+	if damaged, _ := filepath.Glob(path + ".damaged*"); len(damaged) != 0 {
+		t.Errorf("damaged copies: %q, want none", damaged)
+	}
+}
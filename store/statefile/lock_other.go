@@ -0,0 +1,17 @@
+//go:build !unix
+
+package statefile
+
+// Lock does nothing on this platform.
+type Lock struct{}
+
+// Acquire returns a Lock which doesn't prevent other processes from using
+// path, since advisory locks aren't supported on this platform.
+func Acquire(path string) (*Lock, error) {
+	return &Lock{}, nil
+}
+
+// Unlock does nothing.
+func (l *Lock) Unlock() error {
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package statefile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Lock is an advisory lock on a file, held until Unlock, or the process
+// exits.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire locks path + ".lock", creating it if necessary.  It fails at once
+// if another process holds the lock.
+func Acquire(path string) (*Lock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("locking %s: %s", path, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%s is in use by another slabwatcher", path)
+		}
+		return nil, fmt.Errorf("locking %s: %s", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock.  It may be called more than once.
+func (l *Lock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := l.f.Close() // which releases the lock
+	l.f = nil
+	return err
+}
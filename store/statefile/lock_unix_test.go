@@ -0,0 +1,27 @@
+//go:build unix
+
+package statefile
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slabs.db")
+	l, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(path); err == nil {
+		t.Errorf("acquired a held lock")
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("acquiring a released lock: %s", err)
+	}
+	l.Unlock()
+}
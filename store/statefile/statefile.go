@@ -0,0 +1,206 @@
+// Package statefile writes files which must survive a crash, or a full disk,
+// part way through: they are written to a temporary file, synced, and renamed
+// into place, with timestamped backups of the old versions to recover from if
+// the file is somehow damaged anyway.
+package statefile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeFormat is the timestamp in the name of a backup, it sorts in time
+// order.
+const timeFormat = "20060102T150405.000000000Z"
+
+// File is a file with rotated backups.
+type File struct {
+	Path string
+	// Backups is how many old versions to keep, beside Path
+	Backups int
+	// Every is the minimum time between backups, so frequent writes don't
+	// rotate away every older version.
+	Every time.Duration
+
+	now func() time.Time // replaced by tests
+}
+
+// Write replaces the file with data, first keeping the current version as a
+// backup, if one is due.
+func (f *File) Write(data []byte) error {
+	if err := f.Backup(func(dst string) error { return copyFile(f.Path, dst) }); err != nil {
+		return err
+	}
+	return WriteFile(f.Path, data)
+}
+
+// Read calls parse with the contents of the file.  If parse fails, the file
+// is damaged, and the backups are tried, newest first.  An error reading the
+// file is returned as it is, so a file which doesn't exist is
+// fs.ErrNotExist, even if it has backups: it may have been removed on
+// purpose.
+func (f *File) Read(parse func([]byte) error) error {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+	if err = parse(data); err == nil {
+		return nil
+	}
+	backups, berr := f.List()
+	if berr != nil || len(backups) == 0 {
+		return err
+	}
+	log.Printf("%s is damaged: %s", f.Path, err)
+	for i := len(backups) - 1; i >= 0; i-- {
+		data, berr := os.ReadFile(backups[i])
+		if berr == nil {
+			berr = parse(data)
+		}
+		if berr != nil {
+			log.Printf("backup %s is damaged: %s", backups[i], berr)
+			continue
+		}
+		log.Printf("recovered %s from %s", f.Path, backups[i])
+		return nil
+	}
+	return fmt.Errorf("%s and all its backups are damaged: %s", f.Path, err)
+}
+
+// List returns the paths of the backups, oldest first.
+func (f *File) List() ([]string, error) {
+	dir := filepath.Dir(f.Path)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if _, ok := f.backupTime(path); ok {
+			backups = append(backups, path)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// backupTime returns the time in the name of a backup, and whether path is
+// the name of a backup at all.
+func (f *File) backupTime(path string) (time.Time, bool) {
+	name := strings.TrimPrefix(filepath.Base(path), filepath.Base(f.Path)+".")
+	if name == filepath.Base(path) || !strings.HasSuffix(name, ".bak") {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timeFormat, strings.TrimSuffix(name, ".bak"))
+	return t, err == nil
+}
+
+// Backup calls save to write a new backup, if the newest is older than Every,
+// and removes the oldest backups beyond the limit.  If save returns
+// fs.ErrNotExist, there is nothing to back up yet.
+func (f *File) Backup(save func(dst string) error) error {
+	if f.Backups <= 0 {
+		return nil
+	}
+	now := time.Now
+	if f.now != nil {
+		now = f.now
+	}
+	t := now().UTC()
+	backups, err := f.List()
+	if err != nil {
+		return fmt.Errorf("listing backups: %s", err)
+	}
+	if n := len(backups); n > 0 {
+		if last, _ := f.backupTime(backups[n-1]); t.Sub(last) < f.Every {
+			return nil
+		}
+	}
+	path := fmt.Sprintf("%s.%s.bak", f.Path, t.Format(timeFormat))
+	if err := save(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("backing up %s: %s", f.Path, err)
+	}
+	backups = append(backups, path)
+	for len(backups) > f.Backups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("removing old backup: %s", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// copyFile hard links src to dst, or copies it if that isn't possible.  The
+// file is never modified in place, so the link is as good as a copy.
+func copyFile(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return WriteFile(dst, data)
+}
+
+// WriteFile writes data to a temporary file beside path, syncs it, and
+// renames it over path, so a crash leaves either the old or the new version.
+// The file is only readable by its owner.
+func WriteFile(path string, data []byte) error {
+	return WriteFileMode(path, data, 0600)
+}
+
+// WriteFileMode is WriteFile, for a file with the given permissions, eg. one
+// to be published.
+func WriteFileMode(path string, data []byte, perm fs.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	// Sync the directory too, so the rename itself survives a crash.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
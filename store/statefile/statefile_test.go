@@ -0,0 +1,87 @@
+package statefile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slabs.json")
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	f := &File{Path: path, Backups: 2, Every: time.Hour, now: func() time.Time { return now }}
+	read := func() string {
+		t.Helper()
+		var got string
+		if err := f.Read(func(b []byte) error {
+			if string(b) == "damaged" {
+				return errors.New("invalid")
+			}
+			got = string(b)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if err := f.Read(func([]byte) error { return nil }); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("reading a new file: %v, want fs.ErrNotExist", err)
+	}
+
+	// Every version is backed up at most hourly, and only two are kept.
+	for i, v := range []string{"v1", "v2", "v3", "v4", "v5"} {
+		if err := f.Write([]byte(v)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Duration(i) * 40 * time.Minute)
+	}
+	var got []string
+	backups, err := f.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range backups {
+		data, err := os.ReadFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+	}
+	if diff := cmp.Diff([]string{"v3", "v4"}, got); diff != "" {
+		t.Errorf("backups:\n%s", diff)
+	}
+	if got := read(); got != "v5" {
+		t.Errorf("read %q, want v5", got)
+	}
+
+	// A damaged file is recovered from the newest good backup.
+	if err := os.WriteFile(backups[1], []byte("damaged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("damaged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "v3" {
+		t.Errorf("recovered %q, want v3", got)
+	}
+
+	// A file which was removed, or can't be read, isn't replaced by a
+	// backup.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Read(func([]byte) error { return nil }); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("reading a removed file: %v, want fs.ErrNotExist", err)
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Read(func([]byte) error { return nil }); err == nil {
+		t.Errorf("reading a directory succeeded")
+	}
+}
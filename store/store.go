@@ -0,0 +1,118 @@
+// Package store keeps the watcher's state between runs: the known slabs, what
+// was seen in each fetch cycle, and which profiles were notified about which
+// slabs.
+//
+// There are two implementations, jsonstore which keeps the latest state in
+// JSON files, and sqlite which also keeps every cycle's observations, and can
+// be queried.  The watcher makes all of a cycle's changes in one Tx, so a
+// crash leaves the state as it was at the end of a cycle.  The exception is
+// jsonstore, which writes its two files one after the other; see its Commit.
+package store
+
+import (
+	"time"
+
+	"github.com/asjoyner/slabfinder"
+)
+
+// Notified records when each profile was notified about each slab, by profile
+// name and then Slab.ID().
+type Notified map[string]map[uint64]time.Time
+
+// Run is one fetch cycle.
+type Run struct {
+	Time    time.Time
+	Vendors []VendorStatus
+}
+
+// VendorStatus is the outcome of one fetcher in a Run.
+type VendorStatus struct {
+	Fetcher  string
+	Vendor   slabfinder.Vendor
+	Slabs    int // how many were fetched
+	Duration time.Duration
+	Err      string // empty if the fetch succeeded
+}
+
+// Store holds the state.  It is not safe for concurrent use.
+type Store interface {
+	// Slabs returns all the known slabs, by Slab.ID().
+	Slabs() (map[uint64]slabfinder.Slab, error)
+	// Notified returns which slabs each profile has been notified about.
+	Notified() (Notified, error)
+	// Begin starts recording a Run.  A zero Run is for changes made outside
+	// a cycle, like importing another Store, and can't Observe slabs.
+	Begin(r Run) (Tx, error)
+	Close() error
+}
+
+// Tx is the changes made by one Run, which are saved together by Commit.
+type Tx interface {
+	// PutSlab records the latest state of a slab.
+	PutSlab(id uint64, s slabfinder.Slab) error
+	// DeleteSlab forgets a slab, and who was notified about it.
+	DeleteSlab(id uint64) error
+	// Observe records that the slab was fetched in this Run.
+	Observe(id uint64, s slabfinder.Slab) error
+	// Notify records that a profile was notified about a slab.
+	Notify(profile string, id uint64, t time.Time) error
+	// Commit saves the changes.  It is atomic, except in jsonstore.
+	Commit() error
+	// Rollback abandons the changes.  It does nothing after Commit.
+	Rollback() error
+}
+
+// History is implemented by Stores which keep every Run, so the inventory can
+// be queried over time.
+type History interface {
+	// Runs returns the Runs from from to to, inclusive, oldest first.
+	Runs(from, to time.Time) ([]Run, error)
+	// Inventory returns the slabs in stock at t, as of the last successful
+	// fetch of each vendor by then.  Each slab's count, price and size are
+	// as they were observed, and its History stops at t.
+	Inventory(t time.Time) ([]slabfinder.Slab, error)
+	// Stock returns how much of each color each vendor had in stock in each
+	// Run from from to to, inclusive.  Vendors whose fetch failed in a Run
+	// are left out of it, since their counts are incomplete.
+	Stock(from, to time.Time) ([]Stock, error)
+}
+
+// Stock is how much of one color one vendor had in stock in one Run.
+type Stock struct {
+	Time    time.Time
+	Vendor  slabfinder.Vendor
+	Color   string
+	Bundles int // how many lots or bundles were listed
+	Slabs   int // the total count of slabs in them
+}
+
+// Copy copies the known slabs and notified records of src into dst, in one
+// Tx, and returns how many slabs there were.
+func Copy(dst, src Store) (int, error) {
+	slabs, err := src.Slabs()
+	if err != nil {
+		return 0, err
+	}
+	notified, err := src.Notified()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := dst.Begin(Run{})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for id, s := range slabs {
+		if err := tx.PutSlab(id, s); err != nil {
+			return 0, err
+		}
+	}
+	for profile, ids := range notified {
+		for id, t := range ids {
+			if err := tx.Notify(profile, id, t); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(slabs), tx.Commit()
+}